@@ -1,5 +1,6 @@
 openssl req -config openssl.conf \
   -newkey rsa:2048 \
   -nodes -x509 \
+  -days 3650 \
   -keyout test_server.key.pem \
   -out test_server.crt.pem
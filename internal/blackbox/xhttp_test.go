@@ -57,7 +57,26 @@ func TestXHTTPNewClient(t *testing.T) {
 		c := xhttp.NewClient("https://" + tlsAddr.String() + "/ping")
 		_, err := c.Get()
 		xt.KO(t, err)
-		xt.Match(t, ".*x509: cannot validate certificate for .*", err.Error())
+		xt.Match(t, ".*x509: certificate signed by unknown authority.*", err.Error())
+	})
+
+	t.Run("using TLS with functional option WithTLSRootCAFile", func(t *testing.T) {
+		c := xhttp.NewClient("https://"+tlsAddr.String()+"/ping",
+			xhttp.WithTLSRootCAFile("_data/test_server.crt.pem"))
+		req, err := c.Get()
+		xt.OK(t, err)
+		body, err := ioutil.ReadAll(req.Body)
+		xt.OK(t, err)
+		xt.Eq(t, "pong", string(body))
+	})
+
+	t.Run("using TLS with functional option WithTLSServerName", func(t *testing.T) {
+		c := xhttp.NewClient("https://"+tlsAddr.String()+"/ping",
+			xhttp.WithTLSRootCAFile("_data/test_server.crt.pem"),
+			xhttp.WithTLSServerName("example.com"))
+		_, err := c.Get()
+		xt.KO(t, err)
+		xt.Match(t, ".*x509: certificate is valid for .*, not example.com", err.Error())
 	})
 
 	t.Run("using TLS with functional option WithTLSInsecure", func(t *testing.T) {
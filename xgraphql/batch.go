@@ -0,0 +1,82 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Operation is a GraphQL operation executed as part of a batch using
+// Client.ExecuteBatch.
+type Operation struct {
+	Query         string
+	OperationName string
+	Variables     Variables
+
+	// Result receives the data of the response of the operation.
+	Result interface{}
+
+	// Err is set by Client.ExecuteBatch to the errors of the operation as
+	// GraphQLErrors, or nil when it succeeded.
+	Err error
+}
+
+// ExecuteBatch executes ops using a single HTTP request. The server must
+// support batching, replying with a list of responses in the same order.
+// The data of each response is stored in the Result of the operation, and
+// its errors in Err. The returned error is only set when the request as a
+// whole failed. Persisted queries are not used for batches.
+//
+// For example:
+//
+//     hero := &xgraphql.Operation{Query: heroQuery, Result: &heroData}
+//     films := &xgraphql.Operation{Query: filmsQuery, Result: &filmsData}
+//     if err := c.ExecuteBatch(ctx, []*xgraphql.Operation{hero, films}); err != nil {
+//         return err
+//     }
+//     if hero.Err != nil {
+//         ...
+//     }
+func (c Client) ExecuteBatch(ctx context.Context, ops []*Operation, options ...ExecuteOption) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	opts := newExecuteOptions(options)
+
+	payloads := make([]Payload, len(ops))
+	for i, op := range ops {
+		payloads[i] = Payload{
+			Query:         op.Query,
+			OperationName: op.OperationName,
+			Variables:     op.Variables,
+		}
+	}
+
+	buf, err := c.post(ctx, payloads, opts)
+	if err != nil {
+		return err
+	}
+
+	var results []resultData
+	if err := json.Unmarshal(buf, &results); err != nil {
+		// servers not supporting batching reply with a single response
+		var data resultData
+		if json.Unmarshal(buf, &data) == nil && len(data.Errors) > 0 {
+			return data.Errors
+		}
+		return fmt.Errorf("xgraphql: decoding batch response (%w)", err)
+	}
+
+	if len(results) != len(ops) {
+		return fmt.Errorf("xgraphql: got %d responses for batch of %d operations", len(results), len(ops))
+	}
+
+	for i, op := range ops {
+		op.Err = results[i].decode(op.Result)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestClient_ExecuteBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payloads []Payload
+		if err := json.NewDecoder(r.Body).Decode(&payloads); err != nil {
+			_, _ = w.Write([]byte(`{"errors": [{"message": "batching not supported"}]}`))
+			return
+		}
+
+		var results []Response
+		for _, p := range payloads {
+			switch p.OperationName {
+			case "Hero":
+				results = append(results, Response{Data: json.RawMessage(`{"hero": {"name": "R2-D2"}}`)})
+			default:
+				results = append(results, Response{Errors: GraphQLErrors{{Message: "unknown operation"}}})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(results)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	t.Run("results per operation", func(t *testing.T) {
+		var hero struct {
+			Hero struct {
+				Name string `json:"name"`
+			} `json:"hero"`
+		}
+		var other map[string]interface{}
+
+		ops := []*Operation{
+			{Query: `query Hero { hero { name } }`, OperationName: "Hero", Result: &hero},
+			{Query: `query Other { other }`, OperationName: "Other", Result: &other},
+		}
+		xt.OK(t, c.ExecuteBatch(context.Background(), ops))
+
+		xt.OK(t, ops[0].Err)
+		xt.Eq(t, "R2-D2", hero.Hero.Name)
+		xt.KO(t, ops[1].Err)
+		xt.Eq(t, "unknown operation", ops[1].Err.Error())
+		xt.Assert(t, other == nil)
+	})
+
+	t.Run("batching not supported", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"errors": [{"message": "batching not supported"}]}`))
+		}))
+		defer server.Close()
+
+		err := NewClient(server.URL).ExecuteBatch(context.Background(), []*Operation{{Query: "{ a }"}})
+		xt.KO(t, err)
+		xt.Eq(t, "batching not supported", err.Error())
+	})
+}
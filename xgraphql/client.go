@@ -3,10 +3,14 @@
 package xgraphql
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/http"
+	"time"
 
 	"github.com/geertjanvdk/xkit/xhttp"
 )
@@ -15,15 +19,40 @@ import (
 // variables when executing GraphQL queries.
 type Variables map[string]interface{}
 
+// acceptResponse is the value of the Accept header of requests.
+const acceptResponse = "application/graphql-response+json, application/json;q=0.9"
+
 type resultData struct {
 	Data   json.RawMessage `json:"data"`
-	Errors []Error         `json:"errors"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// decode decodes the data of d into result, and returns the errors of d.
+// If result implements the xgraphql.BlackHoler interface, the data is
+// discarded.
+func (d resultData) decode(result interface{}) error {
+	if _, isABlackHole := result.(BlackHoler); !isABlackHole && result != nil && hasData(d.Data) {
+		if err := json.Unmarshal(d.Data, result); err != nil {
+			return fmt.Errorf("xgraphql: decoding data (%w)", err)
+		}
+	}
+
+	if len(d.Errors) > 0 {
+		return d.Errors
+	}
+
+	return nil
 }
 
 // Client defines a GraphQL client connecting to the endpoint using
 // HTTP.
 type Client struct {
 	*xhttp.Client
+
+	// PersistedQueries enables Automatic Persisted Queries: only the
+	// SHA-256 hash of the query is sent, and the full query only when the
+	// server does not know it yet.
+	PersistedQueries bool
 }
 
 // NewClient returns a new GraphQL Client connecting to server using
@@ -37,8 +66,10 @@ func NewClient(uri string, options ...xhttp.ClientOption) *Client {
 
 // Payload defines what we send to the GraphQL endpoint.
 type Payload struct {
-	Query     string    `json:"query"`
-	Variables Variables `json:"variables,omitempty"`
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     Variables              `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
 }
 
 // BlackHoler can be implemented by struct types for which the API result is not
@@ -47,12 +78,43 @@ type BlackHoler interface {
 	DiscardResult()
 }
 
+// ExecuteOption is a functional option for Client.ExecuteContext, and
+// Client.Subscribe.
+type ExecuteOption func(*executeOptions)
+
+type executeOptions struct {
+	header        http.Header
+	operationName string
+
+	// used by Client.Subscribe
+	connectionParams map[string]interface{}
+	keepAlive        time.Duration
+	reconnectDelay   time.Duration
+}
+
+// WithHeader is a functional option for Client.ExecuteContext setting
+// the HTTP header key to value for a single request.
+func WithHeader(key, value string) ExecuteOption {
+	return func(options *executeOptions) {
+		options.header.Set(key, value)
+	}
+}
+
+// WithOperationName is a functional option for Client.ExecuteContext
+// selecting the operation to execute when the query document contains
+// more than one.
+func WithOperationName(name string) ExecuteOption {
+	return func(options *executeOptions) {
+		options.operationName = name
+	}
+}
+
 // Execute executes the GraphQL query and stores payload in result using the
 // connection information found in c.
 // If result implements the xgraphql.BlackHoler interface, the result is
 // discarded (not decoded).
 func (c Client) Execute(query string, result interface{}) error {
-	return c.execute(query, result, nil)
+	return c.ExecuteContext(context.Background(), query, result, nil)
 }
 
 // ExecuteWithVars executes the GraphQL query with variables in vars and
@@ -60,48 +122,117 @@ func (c Client) Execute(query string, result interface{}) error {
 // If result implements the xgraphql.BlackHoler interface, the result is
 // discarded (not decoded).
 func (c Client) ExecuteWithVars(query string, result interface{}, vars Variables) error {
-	return c.execute(query, result, vars)
+	return c.ExecuteContext(context.Background(), query, result, vars)
 }
 
-func (c Client) execute(query string, result interface{}, vars Variables) error {
-	payload := &Payload{
-		Query:     query,
-		Variables: vars,
+// ExecuteContext executes the GraphQL query with variables in vars using
+// ctx, and stores the data of the response in result.
+//
+// When the response contains errors, they are returned as GraphQLErrors.
+// Data which is present in the same response, for example when only some
+// fields could not be resolved, is still decoded into result. When the
+// server replies with an HTTP status code which is not 2xx, and the body
+// does not contain GraphQL errors, the error is *xhttp.StatusError.
+//
+// For example, sending a header with a single request:
+//
+//     err := c.ExecuteContext(ctx, query, &result, xgraphql.Variables{"id": id},
+//         xgraphql.WithHeader("X-Request-ID", requestID))
+func (c Client) ExecuteContext(ctx context.Context, query string, result interface{}, vars Variables,
+	options ...ExecuteOption) error {
+	opts := newExecuteOptions(options)
+
+	payload := Payload{
+		Query:         query,
+		OperationName: opts.operationName,
+		Variables:     vars,
 	}
 
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return err
+	if c.PersistedQueries {
+		payload.Query = ""
+		payload.Extensions = persistedQueryExtensions(query)
+
+		data, err := c.send(ctx, payload, opts)
+		if err != nil {
+			return err
+		}
+		if !data.Errors.persistedQueryNotFound() {
+			return data.decode(result)
+		}
+
+		payload.Query = query
 	}
 
-	resp, err := c.Client.Post(bytes.NewReader(body))
+	data, err := c.send(ctx, payload, opts)
 	if err != nil {
 		return err
 	}
+	return data.decode(result)
+}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed sending request; got %d", resp.StatusCode)
+func newExecuteOptions(options []ExecuteOption) *executeOptions {
+	opts := &executeOptions{header: http.Header{}}
+	for _, o := range options {
+		o(opts)
 	}
+	return opts
+}
+
+// send posts payload and decodes the response.
+func (c Client) send(ctx context.Context, payload Payload, opts *executeOptions) (resultData, error) {
+	var data resultData
 
-	buf, err := ioutil.ReadAll(resp.Body)
+	buf, err := c.post(ctx, payload, opts)
 	if err != nil {
-		return err
+		return data, err
 	}
 
-	var data resultData
 	if err := json.Unmarshal(buf, &data); err != nil {
-		return err
+		return data, fmt.Errorf("xgraphql: decoding response (%w)", err)
+	}
+	return data, nil
+}
+
+// post sends v encoded as JSON, and returns the response body. When the
+// server replies with an HTTP status code which is not 2xx, but the body
+// contains GraphQL errors, the body is returned as well.
+func (c Client) post(ctx context.Context, v interface{}, opts *executeOptions) ([]byte, error) {
+	req := c.Client.NewRequest(ctx, http.MethodPost, c.URI).
+		Header(xhttp.HeaderAccept, acceptResponse).
+		JSON(v)
+	for k := range opts.header {
+		req.Header(k, opts.header.Get(k))
 	}
 
-	if len(data.Errors) > 0 {
-		return data.Errors[0]
+	var buf []byte
+	if _, err := req.Do(&buf); err != nil {
+		var errStatus *xhttp.StatusError
+		if errors.As(err, &errStatus) {
+			var data resultData
+			if json.Unmarshal(errStatus.Body, &data) == nil && len(data.Errors) > 0 {
+				return errStatus.Body, nil
+			}
+		}
+		return nil, err
 	}
 
-	if _, isABlackHole := result.(BlackHoler); isABlackHole {
-		// apparently, we are not interested in the result
-		return nil
+	return buf, nil
+}
+
+// persistedQueryExtensions returns the extensions of a request using
+// Automatic Persisted Queries for query.
+func persistedQueryExtensions(query string) map[string]interface{} {
+	h := sha256.Sum256([]byte(query))
+	return map[string]interface{}{
+		"persistedQuery": map[string]interface{}{
+			"version":    1,
+			"sha256Hash": hex.EncodeToString(h[:]),
+		},
 	}
+}
 
-	err = json.Unmarshal(data.Data, result)
-	return err
+// hasData returns whether data holds a result, which is not the case
+// when the response has no data, or when it is null.
+func hasData(data json.RawMessage) bool {
+	return len(data) > 0 && string(data) != "null"
 }
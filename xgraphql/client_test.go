@@ -3,17 +3,23 @@
 package xgraphql
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/geertjanvdk/xkit/xhttp"
+	"github.com/geertjanvdk/xkit/xhttp/xhttptest"
 	"github.com/geertjanvdk/xkit/xt"
 )
 
@@ -123,13 +129,188 @@ func TestClient_Execute(t *testing.T) {
 	})
 }
 
+func TestClient_ExecuteContext(t *testing.T) {
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+
+		var payload Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch payload.Query {
+		case "partial":
+			_, _ = w.Write([]byte(`{
+				"data": {"hero": {"name": "R2-D2", "friends": [{"name": "Luke"}, null]}},
+				"errors": [
+					{"message": "friend not found", "path": ["hero", "friends", 1],
+					 "locations": [{"line": 1, "column": 20}]},
+					{"message": "database unavailable"}
+				]
+			}`))
+		case "invalid":
+			w.Header().Set(xhttp.HeaderContentType, "application/graphql-response+json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": [{"message": "syntax error", "locations": [{"line": 1, "column": 1}]}]}`))
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("try again later"))
+		default:
+			_, _ = w.Write([]byte(`{"data": {"hero": {"name": "R2-D2"}}}`))
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	type hero struct {
+		Hero struct {
+			Name    string `json:"name"`
+			Friends []*struct {
+				Name string `json:"name"`
+			} `json:"friends"`
+		} `json:"hero"`
+	}
+
+	t.Run("per-request headers", func(t *testing.T) {
+		var data hero
+		xt.OK(t, c.ExecuteContext(context.Background(), "hero", &data, nil,
+			WithHeader("X-Request-ID", "e3b0c442")))
+		xt.Eq(t, "R2-D2", data.Hero.Name)
+		xt.Eq(t, "e3b0c442", gotHeader.Get("X-Request-ID"))
+
+		xt.OK(t, c.ExecuteContext(context.Background(), "hero", &data, nil))
+		xt.Eq(t, "", gotHeader.Get("X-Request-ID"))
+	})
+
+	t.Run("partial data and all errors", func(t *testing.T) {
+		var data hero
+		err := c.ExecuteContext(context.Background(), "partial", &data, nil)
+		xt.KO(t, err)
+		xt.Eq(t, "friend not found; database unavailable", err.Error())
+
+		var errs GraphQLErrors
+		xt.Assert(t, errors.As(err, &errs))
+		xt.Eq(t, 2, len(errs))
+		xt.Eq(t, []interface{}{"hero", "friends", float64(1)}, errs[0].Path)
+		xt.Eq(t, []Location{{Line: 1, Column: 20}}, errs[0].Locations)
+
+		xt.Eq(t, "R2-D2", data.Hero.Name)
+		xt.Eq(t, 2, len(data.Hero.Friends))
+		xt.Eq(t, "Luke", data.Hero.Friends[0].Name)
+	})
+
+	t.Run("errors with HTTP status", func(t *testing.T) {
+		var data hero
+		err := c.ExecuteContext(context.Background(), "invalid", &data, nil)
+		var errs GraphQLErrors
+		xt.Assert(t, errors.As(err, &errs))
+		xt.Eq(t, "syntax error", errs[0].Message)
+
+		err = c.ExecuteContext(context.Background(), "unavailable", &data, nil)
+		var errStatus *xhttp.StatusError
+		xt.Assert(t, errors.As(err, &errStatus))
+		xt.Eq(t, http.StatusServiceUnavailable, errStatus.StatusCode)
+		xt.Eq(t, "try again later", string(errStatus.Body))
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var data hero
+		err := c.ExecuteContext(ctx, "hero", &data, nil)
+		xt.Assert(t, errors.Is(err, context.Canceled))
+	})
+}
+
+func TestClient_PersistedQueries(t *testing.T) {
+	const query = `query Hero { hero { name } }`
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(query)))
+
+	var mu sync.Mutex
+	var payloads []Payload
+	known := map[string]bool{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		payloads = append(payloads, payload)
+
+		pq, _ := payload.Extensions["persistedQuery"].(map[string]interface{})
+		h, _ := pq["sha256Hash"].(string)
+		if payload.Query == "" && !known[h] {
+			_, _ = w.Write([]byte(`{"errors": [{"message": "PersistedQueryNotFound",
+				"extensions": {"code": "PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+		known[h] = true
+		_, _ = w.Write([]byte(`{"data": {"hero": {"name": "R2-D2"}}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.PersistedQueries = true
+
+	for i := 0; i < 2; i++ {
+		var data map[string]interface{}
+		xt.OK(t, c.ExecuteContext(context.Background(), query, &data, nil, WithOperationName("Hero")))
+		xt.Eq(t, map[string]interface{}{"hero": map[string]interface{}{"name": "R2-D2"}}, data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	xt.Eq(t, 3, len(payloads), "expected hash, full query, and hash again")
+	for i, query := range []string{"", query, ""} {
+		xt.Eq(t, query, payloads[i].Query)
+		xt.Eq(t, "Hero", payloads[i].OperationName)
+		pq := payloads[i].Extensions["persistedQuery"].(map[string]interface{})
+		xt.Eq(t, hash, pq["sha256Hash"])
+	}
+}
+
+func TestExtension_UnmarshalJSON(t *testing.T) {
+	var errs GraphQLErrors
+	xt.OK(t, json.Unmarshal([]byte(`[
+		{"message": "a", "extensions": {"code": 1234, "timestamp": "2022-03-01T10:00:00Z"}},
+		{"message": "b", "extensions": {"code": "UNAUTHENTICATED", "timestamp": "yesterday"}}
+	]`), &errs))
+
+	xt.Eq(t, 1234, errs[0].Extensions.Code)
+	xt.Eq(t, 2022, errs[0].Extensions.Timestamp.Year())
+	xt.Eq(t, 0, errs[1].Extensions.CodeAsInt())
+	xt.Eq(t, "UNAUTHENTICATED", errs[1].Extensions.Name)
+	xt.Assert(t, errs[1].Extensions.Timestamp.IsZero())
+}
+
+func TestExtension_MarshalJSON(t *testing.T) {
+	for _, ex := range []Extension{{Code: 1234}, {Name: "UNAUTHENTICATED"}} {
+		data, err := json.Marshal(ex)
+		xt.OK(t, err)
+
+		var got Extension
+		xt.OK(t, json.Unmarshal(data, &got))
+		xt.Eq(t, ex, got)
+	}
+
+	data, err := json.Marshal(Extension{Code: 1234})
+	xt.OK(t, err)
+	xt.Match(t, `"codeHex":"0x04d2"`, string(data))
+}
+
 func handlerGraphQLSWAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(xhttp.ContentTypeJSON, r.Header.Get(xhttp.HeaderContentType))
 	w.WriteHeader(http.StatusOK)
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		err.Error()
 		_, _ = w.Write([]byte("failed reading body"))
 	}
 
@@ -160,3 +341,43 @@ func handlerGraphQLSWAPI(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("failed writing body"))
 	}
 }
+
+func TestClient_Recorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handlerGraphQLSWAPI))
+	defer server.Close()
+
+	golden := filepath.Join(t.TempDir(), "allFilms.json")
+	query := "query {\n  allFilms {\n    films {\n      title\n    }\n  }\n}"
+
+	// run executes the query using rec, and returns the number of films
+	run := func(t *testing.T, rec *xhttptest.Recorder) int {
+		c := NewClient(server.URL, xhttp.WithRoundTripper(rec), xhttp.WithBearer("s3cret"))
+
+		var data struct {
+			AllFilms struct {
+				Films []struct {
+					Title string `json:"title"`
+				} `json:"films"`
+			} `json:"allFilms"`
+		}
+		xt.OK(t, c.ExecuteContext(context.Background(), query, &data, nil))
+		return len(data.AllFilms.Films)
+	}
+
+	t.Run("record", func(t *testing.T) {
+		rec, err := xhttptest.NewRecorder(golden, xhttptest.ModeRecord)
+		xt.OK(t, err)
+		xt.Eq(t, 9, run(t, rec))
+		xt.OK(t, rec.Save())
+
+		xt.Eq(t, xhttptest.Redacted, rec.Interactions()[0].Request.Header.Get(xhttp.HeaderAuthorization))
+	})
+
+	server.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		rec, err := xhttptest.NewRecorder(golden, xhttptest.ModeReplay)
+		xt.OK(t, err)
+		xt.Eq(t, 9, run(t, rec))
+	})
+}
@@ -0,0 +1,438 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ID is the GraphQL ID type. Use it for variables which are declared as
+// `ID!` instead of `String!`.
+type ID string
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// BuildQuery returns the GraphQL query described by q, which is a struct
+// or a pointer to a struct. Each exported field is selected; its name in
+// the query is the name of the Go field starting with a lower case
+// letter, or the value of the `graphql` struct tag. The tag holds the
+// field as written in the query, including alias and arguments, or an
+// inline fragment. Fields tagged `graphql:"-"` are not selected. Struct
+// fields get a selection set, unless they implement json.Unmarshaler, like
+// time.Time does. Fields of embedded structs are selected as if they were
+// fields of the outer struct; embedded pointers to unexported structs can
+// not be used.
+//
+// The variables in vars are declared using the GraphQL type of their Go
+// value: string is String!, integers are Int!, floats are Float!, bool is
+// Boolean!, slices are lists, and other named types, like xgraphql.ID or
+// enumerations, use the name of the Go type. Pointers are nullable.
+//
+// For example:
+//
+//     var q struct {
+//         User struct {
+//             Name    string
+//             Friends []struct {
+//                 Name string
+//             } `graphql:"friends(first: $first)"`
+//             Droid struct {
+//                 PrimaryFunction string
+//             } `graphql:"... on Droid"`
+//         } `graphql:"user(id: $id)"`
+//     }
+//     query, err := xgraphql.BuildQuery(q, xgraphql.Variables{"id": xgraphql.ID("1000"), "first": 10})
+//
+// builds the query:
+//
+//     query ($first: Int!, $id: ID!) { user(id: $id) { name friends(first: $first) { name } ... on Droid { primaryFunction } } }
+func BuildQuery(q interface{}, vars Variables) (string, error) {
+	return buildOperation("query", "", q, vars)
+}
+
+// BuildMutation returns the GraphQL mutation described by m. See
+// BuildQuery for how m and vars are used.
+func BuildMutation(m interface{}, vars Variables) (string, error) {
+	return buildOperation("mutation", "", m, vars)
+}
+
+// Query builds the query described by q using BuildQuery, executes it with
+// variables in vars, and decodes the data of the response into q, which must
+// be a pointer to a struct. Errors are handled like Client.ExecuteContext
+// does.
+//
+// For example:
+//
+//     var q struct {
+//         User struct {
+//             Name string
+//         } `graphql:"user(id: $id)"`
+//     }
+//     if err := c.Query(ctx, &q, xgraphql.Variables{"id": xgraphql.ID(id)}); err != nil {
+//         return err
+//     }
+func (c Client) Query(ctx context.Context, q interface{}, vars Variables, options ...ExecuteOption) error {
+	return c.executeOperation(ctx, "query", q, vars, options)
+}
+
+// Mutate builds the mutation described by m using BuildMutation, executes
+// it with variables in vars, and decodes the data of the response into m,
+// which must be a pointer to a struct.
+func (c Client) Mutate(ctx context.Context, m interface{}, vars Variables, options ...ExecuteOption) error {
+	return c.executeOperation(ctx, "mutation", m, vars, options)
+}
+
+func (c Client) executeOperation(ctx context.Context, operation string, v interface{}, vars Variables,
+	options []ExecuteOption) error {
+	if rv := reflect.ValueOf(v); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("xgraphql: %s must be a non-nil pointer to a struct", operation)
+	}
+
+	query, err := buildOperation(operation, newExecuteOptions(options).operationName, v, vars)
+	if err != nil {
+		return err
+	}
+
+	return c.ExecuteContext(ctx, query, &structResult{v: v}, vars, options...)
+}
+
+// structResult decodes the data of a response like Unmarshal does. Errors
+// are not wrapped, as resultData.decode does that.
+type structResult struct {
+	v interface{}
+}
+
+func (r *structResult) UnmarshalJSON(data []byte) error {
+	return decodeValue(data, reflect.ValueOf(r.v).Elem())
+}
+
+// Unmarshal decodes the data of a GraphQL response into v, which is a
+// pointer to a struct describing the query as explained for BuildQuery.
+// Response fields are matched using the alias or name found in the
+// `graphql` struct tag. This is useful, for example, to decode the results
+// passed to a SubscriptionHandler.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("xgraphql: unmarshal requires a non-nil pointer to a struct (got %T)", v)
+	}
+
+	if err := decodeValue(data, rv.Elem()); err != nil {
+		return fmt.Errorf("xgraphql: decoding data (%w)", err)
+	}
+	return nil
+}
+
+func buildOperation(operation, name string, v interface{}, vars Variables) (string, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", fmt.Errorf("xgraphql: %s must be described using a struct (got %T)", operation, v)
+	}
+
+	var b strings.Builder
+	b.WriteString(operation)
+	if name != "" {
+		b.WriteString(" " + name)
+	}
+
+	if len(vars) > 0 {
+		names := make([]string, 0, len(vars))
+		for n := range vars {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		decls := make([]string, len(names))
+		for i, n := range names {
+			if vars[n] == nil {
+				return "", fmt.Errorf("xgraphql: cannot determine GraphQL type of variable $%s (nil)", n)
+			}
+			typ, err := variableType(reflect.TypeOf(vars[n]))
+			if err != nil {
+				return "", fmt.Errorf("xgraphql: cannot determine GraphQL type of variable $%s (%w)", n, err)
+			}
+			decls[i] = "$" + n + ": " + typ
+		}
+		b.WriteString(" (" + strings.Join(decls, ", ") + ")")
+	}
+
+	b.WriteString(" ")
+	if err := writeSelectionSet(&b, t, map[reflect.Type]bool{}); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// variableType returns the GraphQL type of a variable having Go type t.
+func variableType(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		typ, err := variableType(t.Elem())
+		return strings.TrimSuffix(typ, "!"), err
+	case reflect.Slice, reflect.Array:
+		typ, err := variableType(t.Elem())
+		return "[" + typ + "]!", err
+	}
+
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.Name() + "!", nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "String!", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int!", nil
+	case reflect.Float32, reflect.Float64:
+		return "Float!", nil
+	case reflect.Bool:
+		return "Boolean!", nil
+	}
+
+	return "", fmt.Errorf("unsupported Go type %s", t)
+}
+
+// writeSelectionSet writes the selection set of struct type t to b.
+// Types being written are kept in seen to detect recursion.
+func writeSelectionSet(b *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return fmt.Errorf("xgraphql: cannot select recursive type %s", t)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	b.WriteString("{")
+	n, err := writeFields(b, t, seen)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("xgraphql: no fields to select in %s", t)
+	}
+	b.WriteString(" }")
+
+	return nil
+}
+
+func writeFields(b *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) (int, error) {
+	n := 0
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := fieldTag(f)
+		if !ok {
+			continue
+		}
+		if err := checkEmbedded(f); err != nil {
+			return 0, fmt.Errorf("xgraphql: %w", err)
+		}
+
+		ft := selectionType(f.Type)
+
+		if tag == "" && f.Anonymous {
+			if ft == nil {
+				return 0, fmt.Errorf("xgraphql: embedded field %s must be a struct", f.Name)
+			}
+			c, err := writeFields(b, ft, seen)
+			if err != nil {
+				return 0, err
+			}
+			n += c
+			continue
+		}
+
+		if tag == "" {
+			tag = fieldName(f.Name)
+		}
+		b.WriteString(" " + tag)
+		n++
+
+		if ft != nil {
+			b.WriteString(" ")
+			if err := writeSelectionSet(b, ft, seen); err != nil {
+				return 0, err
+			}
+		} else if isFragment(tag) {
+			return 0, fmt.Errorf("xgraphql: fragment field %s must be a struct", f.Name)
+		}
+	}
+
+	return n, nil
+}
+
+// fieldTag returns the value of the graphql tag of f, and whether f is
+// part of the query.
+func fieldTag(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+	tag := strings.TrimSpace(f.Tag.Get("graphql"))
+	return tag, tag != "-"
+}
+
+// checkEmbedded returns an error when f is an embedded pointer to an
+// unexported struct, as it can not be set when decoding.
+func checkEmbedded(f reflect.StructField) error {
+	if f.Anonymous && f.PkgPath != "" && f.Type.Kind() == reflect.Ptr {
+		return fmt.Errorf("cannot use embedded pointer to unexported struct %s", f.Type.Elem())
+	}
+	return nil
+}
+
+// selectionType returns the struct type of which the fields are selected
+// for a field of type t, or nil when t is a scalar.
+func selectionType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+				return nil
+			}
+			return t
+		}
+		return nil
+	}
+}
+
+func isFragment(tag string) bool {
+	return strings.HasPrefix(tag, "...")
+}
+
+// responseKey returns the key of the field written as tag in the query
+// within the data of the response. This is the alias, or the name of the
+// field.
+func responseKey(tag string) string {
+	head := tag
+	if i := strings.IndexAny(head, "(@"); i > -1 {
+		head = head[:i]
+	}
+	if i := strings.Index(head, ":"); i > -1 {
+		return strings.TrimSpace(head[:i])
+	}
+	return strings.TrimSpace(head)
+}
+
+// fieldName returns the name of the Go struct field name starting with
+// lower case letters, for example `Name` becomes `name`, `ID` becomes
+// `id`, and `URLPath` becomes `urlPath`.
+func fieldName(name string) string {
+	r := []rune(name)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+
+	switch {
+	case n == 0:
+		return name
+	case n == len(r):
+		return strings.ToLower(name)
+	case n > 1:
+		n-- // last upper case letter starts the next word
+	}
+
+	return strings.ToLower(string(r[:n])) + string(r[n:])
+}
+
+// decodeValue decodes data into v, matching fields of structs to the
+// response using their graphql tags.
+func decodeValue(data json.RawMessage, v reflect.Value) error {
+	t := v.Type()
+	if selectionType(t) == nil {
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	if !hasData(data) {
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeValue(data, v.Elem())
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(items), len(items)))
+		}
+		for i := 0; i < len(items) && i < v.Len(); i++ {
+			if err := decodeValue(items[i], v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	return decodeObject(object, v)
+}
+
+// decodeObject decodes the fields of object into struct v.
+func decodeObject(object map[string]json.RawMessage, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := fieldTag(f)
+		if !ok {
+			continue
+		}
+		if err := checkEmbedded(f); err != nil {
+			return err
+		}
+
+		fv := v.Field(i)
+		if isFragment(tag) || (tag == "" && f.Anonymous) {
+			// fields of fragments are found in the same object
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() != reflect.Struct {
+				return fmt.Errorf("fragment field %s must be a struct", f.Name)
+			}
+			if err := decodeObject(object, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := fieldName(f.Name)
+		if tag != "" {
+			key = responseKey(tag)
+		}
+
+		data, ok := object[key]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(data, fv); err != nil {
+			return fmt.Errorf("field %s (%w)", key, err)
+		}
+	}
+
+	return nil
+}
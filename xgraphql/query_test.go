@@ -0,0 +1,234 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+type episode string
+
+type heroQuery struct {
+	Hero struct {
+		ID      ID
+		Name    string
+		Friends []*struct {
+			Name string
+		} `graphql:"friends(first: $first)"`
+		Droid struct {
+			PrimaryFunction string
+		} `graphql:"... on Droid"`
+		Born time.Time
+		note string
+	} `graphql:"hero(episode: $episode)"`
+	Luke *struct {
+		Name string
+	} `graphql:"luke: human(id: \"1000\")"`
+	Ignored string `graphql:"-"`
+}
+
+type person struct {
+	Name string
+}
+
+type node struct {
+	Name     string
+	Children []node
+}
+
+func TestBuildQuery(t *testing.T) {
+	t.Run("fields, arguments, aliases and fragments", func(t *testing.T) {
+		var q heroQuery
+		query, err := BuildQuery(&q, Variables{"episode": episode("JEDI"), "first": 2})
+		xt.OK(t, err)
+		xt.Eq(t, `query ($episode: episode!, $first: Int!) { hero(episode: $episode) { id name `+
+			`friends(first: $first) { name } ... on Droid { primaryFunction } born } `+
+			`luke: human(id: "1000") { name } }`, query)
+	})
+
+	t.Run("variable types", func(t *testing.T) {
+		s := "x"
+		var cases = []struct {
+			value interface{}
+			exp   string
+		}{
+			{"x", "String!"},
+			{int64(1), "Int!"},
+			{1.5, "Float!"},
+			{true, "Boolean!"},
+			{ID("1"), "ID!"},
+			{&s, "String"},
+			{[]int{1}, "[Int!]!"},
+			{[]*ID{}, "[ID]!"},
+		}
+
+		for _, c := range cases {
+			var q struct{ Name string }
+			query, err := BuildQuery(q, Variables{"v": c.value})
+			xt.OK(t, err)
+			xt.Eq(t, "query ($v: "+c.exp+") { name }", query)
+		}
+	})
+
+	t.Run("mutation", func(t *testing.T) {
+		var m struct {
+			CreateReview struct {
+				Stars int
+			} `graphql:"createReview(episode: $episode, stars: $stars)"`
+		}
+		query, err := BuildMutation(&m, Variables{"episode": episode("JEDI"), "stars": 5})
+		xt.OK(t, err)
+		xt.Eq(t, `mutation ($episode: episode!, $stars: Int!) { createReview(episode: $episode, stars: $stars) { stars } }`,
+			query)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := BuildQuery("hero", nil)
+		xt.KO(t, err)
+
+		_, err = BuildQuery(struct{ Tree node }{}, nil)
+		xt.KO(t, err)
+		xt.Eq(t, "xgraphql: cannot select recursive type xgraphql.node", err.Error())
+
+		_, err = BuildQuery(struct{ Hero struct{} }{}, nil)
+		xt.KO(t, err)
+
+		_, err = BuildQuery(struct{ Name string }{}, Variables{"v": map[string]int{}})
+		xt.KO(t, err)
+
+		_, err = BuildQuery(struct{ Name string }{}, Variables{"v": nil})
+		xt.KO(t, err)
+
+		_, err = BuildQuery(struct {
+			*person
+			Age int
+		}{}, nil)
+		xt.KO(t, err)
+		xt.Eq(t, "xgraphql: cannot use embedded pointer to unexported struct xgraphql.person", err.Error())
+	})
+
+	t.Run("embedded struct", func(t *testing.T) {
+		var q struct {
+			person
+			Age int
+		}
+		query, err := BuildQuery(q, nil)
+		xt.OK(t, err)
+		xt.Eq(t, "query { name age }", query)
+	})
+}
+
+func TestUnmarshal(t *testing.T) {
+	var q heroQuery
+	xt.OK(t, Unmarshal([]byte(`{
+		"hero": {
+			"id": "2001",
+			"name": "R2-D2",
+			"friends": [{"name": "Luke Skywalker"}, null],
+			"primaryFunction": "Astromech",
+			"born": "1977-05-25T00:00:00Z"
+		},
+		"luke": {"name": "Luke Skywalker"}
+	}`), &q))
+
+	xt.Eq(t, ID("2001"), q.Hero.ID)
+	xt.Eq(t, "R2-D2", q.Hero.Name)
+	xt.Eq(t, 2, len(q.Hero.Friends))
+	xt.Eq(t, "Luke Skywalker", q.Hero.Friends[0].Name)
+	xt.Assert(t, q.Hero.Friends[1] == nil)
+	xt.Eq(t, "Astromech", q.Hero.Droid.PrimaryFunction)
+	xt.Eq(t, 1977, q.Hero.Born.Year())
+	xt.Assert(t, q.Luke != nil)
+	xt.Eq(t, "Luke Skywalker", q.Luke.Name)
+
+	xt.OK(t, Unmarshal([]byte(`{"hero": null, "luke": null}`), &q))
+	xt.Eq(t, "", q.Hero.Name)
+	xt.Assert(t, q.Luke == nil)
+
+	xt.KO(t, Unmarshal([]byte(`{"hero": {"name": 1}}`), &q))
+	xt.KO(t, Unmarshal([]byte(`{}`), q))
+
+	t.Run("embedded struct", func(t *testing.T) {
+		var q struct {
+			person
+			Age int
+		}
+		xt.OK(t, Unmarshal([]byte(`{"name": "Leia", "age": 19}`), &q))
+		xt.Eq(t, "Leia", q.Name)
+		xt.Eq(t, 19, q.Age)
+
+		var qp struct {
+			*person
+			Age int
+		}
+		err := Unmarshal([]byte(`{"name": "Leia", "age": 19}`), &qp)
+		xt.KO(t, err)
+		xt.Match(t, "embedded pointer to unexported struct", err.Error())
+	})
+}
+
+func TestFieldName(t *testing.T) {
+	var cases = map[string]string{
+		"Name":            "name",
+		"ID":              "id",
+		"URLPath":         "urlPath",
+		"PrimaryFunction": "primaryFunction",
+		"name":            "name",
+	}
+
+	for name, exp := range cases {
+		xt.Eq(t, exp, fieldName(name))
+	}
+}
+
+func TestClient_Query(t *testing.T) {
+	var got Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"data": {"hero": {"id": "2001", "name": "R2-D2", "friends": null}, "luke": null},
+			"errors": [{"message": "friends unavailable", "path": ["hero", "friends"]}]
+		}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+
+	var q heroQuery
+	err := c.Query(context.Background(), &q, Variables{"episode": episode("JEDI"), "first": 2},
+		WithOperationName("Hero"))
+	var errs GraphQLErrors
+	xt.Assert(t, errors.As(err, &errs))
+	xt.Eq(t, "friends unavailable", errs[0].Message)
+
+	xt.Match(t, `^query Hero \(\$episode: episode!, \$first: Int!\) \{ hero\(episode: \$episode\)`, got.Query)
+	xt.Eq(t, "Hero", got.OperationName)
+	xt.Eq(t, "JEDI", got.Variables["episode"])
+	xt.Eq(t, "R2-D2", q.Hero.Name)
+	xt.Eq(t, 0, len(q.Hero.Friends))
+
+	xt.KO(t, c.Query(context.Background(), q, nil))
+
+	t.Run("decoding error is wrapped once", func(t *testing.T) {
+		var q struct {
+			Hero struct {
+				Name int
+			} `graphql:"hero(episode: $episode)"`
+		}
+		err := c.Query(context.Background(), &q, Variables{"episode": episode("JEDI")})
+		xt.KO(t, err)
+		xt.Eq(t, 1, strings.Count(err.Error(), "xgraphql: decoding data"), err.Error())
+	})
+}
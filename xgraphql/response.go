@@ -5,19 +5,24 @@ package xgraphql
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
 // Response represents a GraphQL response.
 type Response struct {
-	Errors []Error         `json:"errors,omitempty"`
+	Errors GraphQLErrors   `json:"errors,omitempty"`
 	Data   json.RawMessage `json:"data,omitempty"`
 }
 
 // Error represents a GraphQL error.
 type Error struct {
-	Message    string     `json:"message"`
-	Extensions *Extension `json:"extensions,omitempty"`
+	Message string `json:"message"`
+	// Path is the path of the response field which failed, made of
+	// field names and list indexes, for example `["hero", "friends", 1]`.
+	Path       []interface{} `json:"path,omitempty"`
+	Locations  []Location    `json:"locations,omitempty"`
+	Extensions *Extension    `json:"extensions,omitempty"`
 }
 
 // Error returns the error a a canonical string.
@@ -25,19 +30,92 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// Location is the location in the GraphQL document of an error.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLErrors holds all errors of a GraphQL response.
+type GraphQLErrors []Error
+
+// Error returns the messages of all errors in errs.
+func (errs GraphQLErrors) Error() string {
+	switch len(errs) {
+	case 0:
+		return "xgraphql: no errors"
+	case 1:
+		return errs[0].Message
+	}
+
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// persistedQueryNotFound returns whether errs tells that the server does
+// not know, or does not support, the persisted query which was sent.
+func (errs GraphQLErrors) persistedQueryNotFound() bool {
+	for _, e := range errs {
+		switch e.Message {
+		case "PersistedQueryNotFound", "PersistedQueryNotSupported":
+			return true
+		}
+		if e.Extensions != nil {
+			switch e.Extensions.Name {
+			case "PERSISTED_QUERY_NOT_FOUND", "PERSISTED_QUERY_NOT_SUPPORTED":
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Extension represent the extension entry for GraphQL errors.
 type Extension struct {
-	Code      int       `json:"code,omitempty"`
+	Code int `json:"code,omitempty"`
+	// Name holds the code when it is not a number, for example
+	// `PERSISTED_QUERY_NOT_FOUND`.
+	Name      string    `json:"-"`
 	Timestamp time.Time `json:"timestamp,omitempty"`
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface. Codes which
+// are strings are stored in Name, and timestamps which can not be parsed
+// are ignored.
+func (ex *Extension) UnmarshalJSON(data []byte) error {
+	var m struct {
+		Code      json.RawMessage `json:"code"`
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*ex = Extension{}
+	if len(m.Timestamp) > 0 {
+		_ = json.Unmarshal(m.Timestamp, &ex.Timestamp)
+	}
+	if len(m.Code) > 0 && json.Unmarshal(m.Code, &ex.Code) != nil {
+		_ = json.Unmarshal(m.Code, &ex.Name)
+	}
+	return nil
+}
+
 // MarshalJSON implements the json.Marshaler interface. It encodes
-// extension ex making it ready to include in a GraphQL response.
+// extension ex making it ready to include in a GraphQL response. When
+// Name is set, it is used as code.
 func (ex Extension) MarshalJSON() ([]byte, error) {
 	m := map[string]interface{}{}
 
-	m["code"] = ex.Code
-	m["codeHex"] = fmt.Sprintf("0x%04x", ex.Code)
+	if ex.Name != "" {
+		m["code"] = ex.Name
+	} else {
+		m["code"] = ex.Code
+		m["codeHex"] = fmt.Sprintf("0x%04x", ex.Code)
+	}
 	m["timestamp"] = ex.Timestamp
 	return json.Marshal(m)
 }
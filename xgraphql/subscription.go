@@ -0,0 +1,313 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xhttp"
+)
+
+const (
+	// graphqlTransportWS is the WebSocket subprotocol used for
+	// subscriptions.
+	graphqlTransportWS = "graphql-transport-ws"
+
+	defaultKeepAlive         = 30 * time.Second
+	defaultReconnectDelay    = time.Second
+	maxReconnectDelay        = 30 * time.Second
+	connectionAckTimeout     = 10 * time.Second
+	subscriptionID           = "1"
+	wsCloseConnectionTimeout = 4408
+)
+
+// Message types of the graphql-transport-ws protocol.
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// SubscriptionHandler is called with each result of a subscription. When
+// the result contains errors, err is GraphQLErrors, and data holds what
+// could be resolved. When the handler returns an error, the subscription
+// stops, and Client.Subscribe returns it.
+type SubscriptionHandler func(data json.RawMessage, err error) error
+
+// wsMessage is a message of the graphql-transport-ws protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// WithConnectionParams is a functional option for Client.Subscribe
+// sending params as payload of the connection_init message. Servers often
+// use it for authentication.
+func WithConnectionParams(params map[string]interface{}) ExecuteOption {
+	return func(options *executeOptions) {
+		options.connectionParams = params
+	}
+}
+
+// WithKeepAlive is a functional option for Client.Subscribe setting how
+// often a ping is sent to keep the connection open. Defaults to 30
+// seconds.
+func WithKeepAlive(d time.Duration) ExecuteOption {
+	return func(options *executeOptions) {
+		options.keepAlive = d
+	}
+}
+
+// WithReconnectDelay is a functional option for Client.Subscribe setting
+// how long to wait before reconnecting when the connection was lost. The
+// delay doubles with each failed attempt, up to 30 seconds. Defaults to 1
+// second.
+func WithReconnectDelay(d time.Duration) ExecuteOption {
+	return func(options *executeOptions) {
+		options.reconnectDelay = d
+	}
+}
+
+// Subscribe executes the subscription query with variables in vars using
+// the graphql-transport-ws protocol over a WebSocket connection, and calls
+// handler with each result. It blocks until the server completes the
+// subscription, returning nil, or until ctx is done, returning its error.
+//
+// When the connection is lost, Subscribe reconnects and subscribes
+// again; results sent in between are lost. It does not reconnect when
+// the server rejects the connection or the subscription; the error is
+// then *xhttp.StatusError, *xhttp.WebSocketCloseError, or GraphQLErrors.
+// The HTTP client of c must not have a timeout.
+//
+// For example:
+//
+//     err := c.Subscribe(ctx, `subscription { reviewAdded { stars } }`, nil,
+//         func(data json.RawMessage, err error) error {
+//             if err != nil {
+//                 log.WithError(err).Warn("review")
+//                 return nil
+//             }
+//             ...
+//         },
+//         xgraphql.WithConnectionParams(map[string]interface{}{"token": token}))
+func (c Client) Subscribe(ctx context.Context, query string, vars Variables, handler SubscriptionHandler,
+	options ...ExecuteOption) error {
+	opts := newExecuteOptions(options)
+	if opts.keepAlive <= 0 {
+		opts.keepAlive = defaultKeepAlive
+	}
+	if opts.reconnectDelay <= 0 {
+		opts.reconnectDelay = defaultReconnectDelay
+	}
+
+	payload := Payload{
+		Query:         query,
+		OperationName: opts.operationName,
+		Variables:     vars,
+	}
+
+	delay := opts.reconnectDelay
+	for {
+		acked, err := c.subscribe(ctx, payload, handler, opts)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err == nil:
+			return nil
+		case !reconnectable(err):
+			var errStopped stoppedError
+			if errors.As(err, &errStopped) {
+				return errStopped.err
+			}
+			return err
+		}
+
+		if acked {
+			delay = opts.reconnectDelay
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// stoppedError is returned when the subscription was stopped by the
+// handler or the server, and must not be resumed.
+type stoppedError struct {
+	err error
+}
+
+func (e stoppedError) Error() string {
+	return e.err.Error()
+}
+
+func (e stoppedError) Unwrap() error {
+	return e.err
+}
+
+// reconnectable returns whether the subscription which failed with err
+// can be resumed using a new connection.
+func reconnectable(err error) bool {
+	var errStopped stoppedError
+	var errStatus *xhttp.StatusError
+	var errClose *xhttp.WebSocketCloseError
+
+	switch {
+	case errors.As(err, &errStopped), errors.As(err, &errStatus):
+		return false
+	case errors.As(err, &errClose):
+		// 4400-4499 are used by servers rejecting the client
+		return errClose.Code < 4400 || errClose.Code > 4499
+	}
+	return true
+}
+
+// subscribe runs the subscription using a single connection. It returns
+// whether the server acknowledged the connection.
+func (c Client) subscribe(ctx context.Context, payload Payload, handler SubscriptionHandler,
+	opts *executeOptions) (bool, error) {
+	ws, err := c.DialWebSocket(ctx, c.URI, xhttp.WebSocketOptions{
+		Subprotocols: []string{graphqlTransportWS},
+		Header:       opts.header,
+	})
+	if err != nil {
+		return false, err
+	}
+	if ws.Subprotocol() != graphqlTransportWS {
+		_ = ws.Close(xhttp.WebSocketCloseProtocolError, "")
+		return false, stoppedError{errors.New("xgraphql: server does not support " + graphqlTransportWS)}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	defer func() { _ = ws.Close(xhttp.WebSocketCloseNormal, "") }()
+
+	acked := make(chan struct{})
+	go func() {
+		ackTimeout := time.NewTimer(connectionAckTimeout)
+		defer ackTimeout.Stop()
+		keepAlive := time.NewTicker(opts.keepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				_ = writeWSMessage(ws, wsMessage{ID: subscriptionID, Type: msgComplete})
+				_ = ws.Close(xhttp.WebSocketCloseNormal, "")
+				return
+			case <-ackTimeout.C:
+				select {
+				case <-acked:
+				default:
+					_ = ws.Close(wsCloseConnectionTimeout, "connection acknowledgement timeout")
+					return
+				}
+			case <-keepAlive.C:
+				_ = writeWSMessage(ws, wsMessage{Type: msgPing})
+			}
+		}
+	}()
+
+	init := wsMessage{Type: msgConnectionInit}
+	if opts.connectionParams != nil {
+		init.Payload, err = json.Marshal(opts.connectionParams)
+		if err != nil {
+			return false, stoppedError{fmt.Errorf("xgraphql: encoding connection params (%w)", err)}
+		}
+	}
+	if err := writeWSMessage(ws, init); err != nil {
+		return false, err
+	}
+
+	isAcked := false
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return isAcked, err
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return isAcked, stoppedError{fmt.Errorf("xgraphql: decoding message (%w)", err)}
+		}
+
+		switch msg.Type {
+		case msgConnectionAck:
+			if isAcked {
+				continue
+			}
+			isAcked = true
+			close(acked)
+
+			p, err := json.Marshal(payload)
+			if err != nil {
+				return isAcked, stoppedError{fmt.Errorf("xgraphql: encoding payload (%w)", err)}
+			}
+			if err := writeWSMessage(ws, wsMessage{ID: subscriptionID, Type: msgSubscribe, Payload: p}); err != nil {
+				return isAcked, err
+			}
+		case msgPing:
+			if err := writeWSMessage(ws, wsMessage{Type: msgPong}); err != nil {
+				return isAcked, err
+			}
+		case msgNext:
+			if msg.ID != subscriptionID {
+				continue
+			}
+			var result resultData
+			if err := json.Unmarshal(msg.Payload, &result); err != nil {
+				return isAcked, stoppedError{fmt.Errorf("xgraphql: decoding result (%w)", err)}
+			}
+			var errResult error
+			if len(result.Errors) > 0 {
+				errResult = result.Errors
+			}
+			if err := handler(result.Data, errResult); err != nil {
+				_ = writeWSMessage(ws, wsMessage{ID: subscriptionID, Type: msgComplete})
+				return isAcked, stoppedError{err}
+			}
+		case msgError:
+			if msg.ID != subscriptionID {
+				continue
+			}
+			var errs GraphQLErrors
+			if err := json.Unmarshal(msg.Payload, &errs); err != nil || len(errs) == 0 {
+				errs = GraphQLErrors{{Message: "xgraphql: subscription failed"}}
+			}
+			return isAcked, stoppedError{errs}
+		case msgComplete:
+			if msg.ID == subscriptionID {
+				return isAcked, nil
+			}
+		}
+	}
+}
+
+func writeWSMessage(ws *xhttp.WebSocket, msg wsMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(xhttp.WebSocketText, data)
+}
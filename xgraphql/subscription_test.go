@@ -0,0 +1,195 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xhttp"
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+// subscriptionServer is a stand-in GraphQL server speaking the
+// graphql-transport-ws protocol. For each connection, script is called
+// after the subscription was received.
+type subscriptionServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	connections int
+	initParams  []map[string]interface{}
+	payloads    []Payload
+	pings       int
+	completed   int
+}
+
+func newSubscriptionServer(script func(s *subscriptionServer, conn int, ws *xhttp.WebSocket, id string)) *subscriptionServer {
+	s := &subscriptionServer{}
+
+	opts := xhttp.WebSocketOptions{Subprotocols: []string{graphqlTransportWS}}
+	s.Server = httptest.NewServer(xhttp.WebSocketHandler(opts, func(ws *xhttp.WebSocket, r *http.Request) {
+		s.mu.Lock()
+		s.connections++
+		conn := s.connections
+		s.mu.Unlock()
+
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg wsMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return
+			}
+
+			switch msg.Type {
+			case msgConnectionInit:
+				var params map[string]interface{}
+				_ = json.Unmarshal(msg.Payload, &params)
+				s.mu.Lock()
+				s.initParams = append(s.initParams, params)
+				s.mu.Unlock()
+				_ = writeWSMessage(ws, wsMessage{Type: msgPing})
+				_ = writeWSMessage(ws, wsMessage{Type: msgConnectionAck})
+			case msgPing:
+				s.mu.Lock()
+				s.pings++
+				s.mu.Unlock()
+				_ = writeWSMessage(ws, wsMessage{Type: msgPong})
+			case msgSubscribe:
+				var p Payload
+				_ = json.Unmarshal(msg.Payload, &p)
+				s.mu.Lock()
+				s.payloads = append(s.payloads, p)
+				s.mu.Unlock()
+				go script(s, conn, ws, msg.ID)
+			case msgComplete:
+				s.mu.Lock()
+				s.completed++
+				s.mu.Unlock()
+			}
+		}
+	}))
+
+	return s
+}
+
+func sendNext(ws *xhttp.WebSocket, id string, result string) {
+	_ = writeWSMessage(ws, wsMessage{ID: id, Type: msgNext, Payload: json.RawMessage(result)})
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	const query = `subscription { reviewAdded { stars } }`
+
+	t.Run("reconnects and completes", func(t *testing.T) {
+		srv := newSubscriptionServer(func(s *subscriptionServer, conn int, ws *xhttp.WebSocket, id string) {
+			switch conn {
+			case 1:
+				sendNext(ws, id, `{"data": {"reviewAdded": {"stars": 1}}}`)
+				time.Sleep(30 * time.Millisecond) // let the client ping
+				_ = ws.Close(xhttp.WebSocketCloseGoingAway, "restarting")
+			default:
+				sendNext(ws, id, `{"data": {"reviewAdded": null}, "errors": [{"message": "review removed"}]}`)
+				sendNext(ws, id, `{"data": {"reviewAdded": {"stars": 5}}}`)
+				_ = writeWSMessage(ws, wsMessage{ID: id, Type: msgComplete})
+			}
+		})
+		defer srv.Close()
+
+		var results []string
+		err := NewClient(srv.URL).Subscribe(context.Background(), query, Variables{"episode": "JEDI"},
+			func(data json.RawMessage, err error) error {
+				results = append(results, fmt.Sprintf("%s %v", data, err))
+				return nil
+			},
+			WithConnectionParams(map[string]interface{}{"token": "secret"}),
+			WithKeepAlive(5*time.Millisecond),
+			WithReconnectDelay(time.Millisecond))
+		xt.OK(t, err)
+
+		xt.Eq(t, []string{
+			`{"reviewAdded":{"stars":1}} <nil>`,
+			`{"reviewAdded":null} review removed`,
+			`{"reviewAdded":{"stars":5}} <nil>`,
+		}, results)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		xt.Eq(t, 2, srv.connections)
+		xt.Eq(t, "secret", srv.initParams[1]["token"])
+		xt.Eq(t, query, srv.payloads[1].Query)
+		xt.Eq(t, "JEDI", srv.payloads[1].Variables["episode"])
+		xt.Assert(t, srv.pings > 0, "expected keepalive pings")
+	})
+
+	t.Run("error stops subscription", func(t *testing.T) {
+		srv := newSubscriptionServer(func(s *subscriptionServer, conn int, ws *xhttp.WebSocket, id string) {
+			_ = writeWSMessage(ws, wsMessage{ID: id, Type: msgError,
+				Payload: json.RawMessage(`[{"message": "unknown field", "locations": [{"line": 1, "column": 16}]}]`)})
+		})
+		defer srv.Close()
+
+		err := NewClient(srv.URL).Subscribe(context.Background(), query, nil,
+			func(json.RawMessage, error) error { return nil })
+		var errs GraphQLErrors
+		xt.Assert(t, errors.As(err, &errs), fmt.Sprint(err))
+		xt.Eq(t, "unknown field", errs[0].Message)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		xt.Eq(t, 1, srv.connections)
+	})
+
+	t.Run("handler error and context", func(t *testing.T) {
+		srv := newSubscriptionServer(func(s *subscriptionServer, conn int, ws *xhttp.WebSocket, id string) {
+			for i := 0; i < 3; i++ {
+				sendNext(ws, id, `{"data": {"reviewAdded": {"stars": 3}}}`)
+			}
+		})
+		defer srv.Close()
+
+		errStop := errors.New("stop")
+		err := NewClient(srv.URL).Subscribe(context.Background(), query, nil,
+			func(json.RawMessage, error) error { return errStop })
+		xt.Eq(t, errStop, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err = NewClient(srv.URL).Subscribe(ctx, query, nil,
+			func(json.RawMessage, error) error {
+				cancel()
+				return nil
+			})
+		xt.Eq(t, context.Canceled, err)
+
+		completed := 0
+		for i := 0; i < 100 && completed < 2; i++ {
+			time.Sleep(5 * time.Millisecond)
+			srv.mu.Lock()
+			completed = srv.completed
+			srv.mu.Unlock()
+		}
+		xt.Eq(t, 2, completed, "expected client to complete the subscription")
+	})
+
+	t.Run("rejected connection", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			xhttp.Error(w, r, http.StatusUnauthorized, "401 unauthorized", nil)
+		}))
+		defer srv.Close()
+
+		err := NewClient(srv.URL).Subscribe(context.Background(), query, nil,
+			func(json.RawMessage, error) error { return nil })
+		var errStatus *xhttp.StatusError
+		xt.Assert(t, errors.As(err, &errStatus))
+		xt.Eq(t, http.StatusUnauthorized, errStatus.StatusCode)
+	})
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultOAuth2RefreshBefore = 30 * time.Second
+
+// Authenticator adds credentials to requests made by Client. It is called
+// for each attempt, and can modify the request.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc is an adapter to use an ordinary function as
+// Authenticator.
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate calls f(req).
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// BasicAuth returns an Authenticator using HTTP Basic authentication.
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// APIKeyHeader returns an Authenticator setting the HTTP header name to
+// key, for example `X-API-Key`.
+func APIKeyHeader(name, key string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set(name, key)
+		return nil
+	})
+}
+
+// APIKeyQuery returns an Authenticator setting the query parameter name
+// to key.
+func APIKeyQuery(name, key string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		q := req.URL.Query()
+		q.Set(name, key)
+		req.URL.RawQuery = q.Encode()
+		return nil
+	})
+}
+
+// OAuth2ClientCredentials is an Authenticator getting access tokens using
+// the OAuth 2.0 client credentials grant (RFC 6749, section 4.4). Tokens
+// are cached and refreshed before they expire. It is safe to use with
+// concurrent requests; only one token request is made at a time.
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// RefreshBefore is how long before the token expires it is refreshed.
+	// Defaults to 30 seconds.
+	RefreshBefore time.Duration
+
+	// HTTPClient is used to request tokens. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time // zero when token does not expire
+}
+
+// Authenticate sets the HTTP Authorization header of req using the access
+// token.
+func (o *OAuth2ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := o.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderAuthorization, "Bearer "+token)
+	return nil
+}
+
+// Token returns the cached access token, or requests a new one when there
+// is none or it is about to expire. When refreshing fails, but the cached
+// token did not expire yet, the cached token is returned.
+func (o *OAuth2ClientCredentials) Token(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	refreshBefore := o.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = defaultOAuth2RefreshBefore
+	}
+
+	now := time.Now()
+	if o.token != "" && (o.expiry.IsZero() || now.Add(refreshBefore).Before(o.expiry)) {
+		return o.token, nil
+	}
+
+	token, expiresIn, err := o.requestToken(ctx)
+	if err != nil {
+		if o.token != "" && now.Before(o.expiry) {
+			return o.token, nil
+		}
+		return "", err
+	}
+
+	o.token = token
+	o.expiry = time.Time{}
+	if expiresIn > 0 {
+		o.expiry = now.Add(expiresIn)
+	}
+	return o.token, nil
+}
+
+// requestToken requests a new access token from the token endpoint.
+func (o *OAuth2ClientCredentials) requestToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set(HeaderContentType, "application/x-www-form-urlencoded")
+	req.Header.Set(HeaderAccept, "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("xhttp: requesting OAuth2 token (%w)", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStatusErrorBody))
+	if err != nil {
+		return "", 0, fmt.Errorf("xhttp: reading OAuth2 token response (%w)", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("xhttp: requesting OAuth2 token (%w)", &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       body,
+		})
+	}
+
+	var doc struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", 0, fmt.Errorf("xhttp: decoding OAuth2 token response (%w)", err)
+	}
+	if doc.AccessToken == "" {
+		return "", 0, errors.New("xhttp: OAuth2 token response has no access token")
+	}
+	if doc.TokenType != "" && !strings.EqualFold(doc.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("xhttp: unsupported OAuth2 token type %q", doc.TokenType)
+	}
+
+	return doc.AccessToken, time.Duration(doc.ExpiresIn) * time.Second, nil
+}
+
+// HMACSigner is an Authenticator signing requests using HMAC-SHA256. The
+// HTTP Authorization header is set to:
+//
+//     HMAC-SHA256 Credential=<KeyID>, Timestamp=<unix>, Signature=<hex>
+//
+// The signature is calculated over the following lines, separated by a
+// newline: the method, the request URI (path and query), the timestamp as
+// Unix time, and the hex encoded SHA-256 of the body.
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+
+	now func() time.Time
+}
+
+// Authenticate signs req.
+func (s *HMACSigner) Authenticate(req *http.Request) error {
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	ts := strconv.FormatInt(now().Unix(), 10)
+
+	sig := HMACSignature(s.Secret, req.Method, req.URL.RequestURI(), ts, body)
+	req.Header.Set(HeaderAuthorization,
+		"HMAC-SHA256 Credential="+s.KeyID+", Timestamp="+ts+", Signature="+sig)
+	return nil
+}
+
+// HMACSignature returns the hex encoded signature as calculated by
+// HMACSigner. It is used by servers to verify requests.
+func HMACSignature(secret []byte, method, requestURI, timestamp string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n" + hex.EncodeToString(bodySum[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestBody returns the body of req, without consuming it.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rc.Close() }()
+		return io.ReadAll(rc)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+// echoAuthServer replies with the Authorization header, the query and the
+// body of the request.
+func echoAuthServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = WriteJSON(w, http.StatusOK, map[string]string{
+			"authorization": r.Header.Get(HeaderAuthorization),
+			"apiKey":        r.Header.Get("X-API-Key"),
+			"query":         r.URL.RawQuery,
+			"body":          string(body),
+		})
+	}))
+}
+
+func TestWithAuthenticator(t *testing.T) {
+	server := echoAuthServer()
+	defer server.Close()
+
+	get := func(t *testing.T, a Authenticator) map[string]string {
+		var got map[string]string
+		c := NewClient(server.URL, WithAuthenticator(a))
+		_, err := c.NewRequest(context.Background(), http.MethodGet, "?a=1").Do(&got)
+		xt.OK(t, err)
+		return got
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		got := get(t, BasicAuth("alice", "s3cret"))
+		xt.Eq(t, "Basic YWxpY2U6czNjcmV0", got["authorization"])
+	})
+
+	t.Run("API key header", func(t *testing.T) {
+		got := get(t, APIKeyHeader("X-API-Key", "k3y"))
+		xt.Eq(t, "k3y", got["apiKey"])
+	})
+
+	t.Run("API key query", func(t *testing.T) {
+		got := get(t, APIKeyQuery("api_key", "k3y"))
+		xt.Eq(t, "a=1&api_key=k3y", got["query"])
+	})
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var tokenRequests int32
+	var failing int32
+	var expiresIn int64 = 3600
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		id, secret, _ := r.BasicAuth()
+		if r.Method != http.MethodPost || id != "svc" || secret != "s3cret" ||
+			r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+
+		n := atomic.AddInt32(&tokenRequests, 1)
+		time.Sleep(10 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d-%s", n, r.FormValue("scope")),
+			"token_type":   "Bearer",
+			"expires_in":   atomic.LoadInt64(&expiresIn),
+		})
+	}))
+	defer tokenServer.Close()
+
+	server := echoAuthServer()
+	defer server.Close()
+
+	t.Run("cached and safe for concurrent use", func(t *testing.T) {
+		oauth := &OAuth2ClientCredentials{
+			TokenURL:     tokenServer.URL,
+			ClientID:     "svc",
+			ClientSecret: "s3cret",
+			Scopes:       []string{"read", "write"},
+		}
+		c := NewClient(server.URL, WithAuthenticator(oauth))
+
+		results := make([]string, 10)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var got map[string]string
+				if _, err := c.NewRequest(context.Background(), http.MethodGet, "").Do(&got); err != nil {
+					results[i] = err.Error()
+					return
+				}
+				results[i] = got["authorization"]
+			}(i)
+		}
+		wg.Wait()
+
+		for _, r := range results {
+			xt.Eq(t, "Bearer token-1-read write", r)
+		}
+		xt.Eq(t, int32(1), atomic.LoadInt32(&tokenRequests))
+	})
+
+	t.Run("refresh before expiry", func(t *testing.T) {
+		atomic.StoreInt32(&tokenRequests, 0)
+		atomic.StoreInt64(&expiresIn, 10)
+		defer atomic.StoreInt64(&expiresIn, 3600)
+
+		oauth := &OAuth2ClientCredentials{TokenURL: tokenServer.URL, ClientID: "svc", ClientSecret: "s3cret"}
+		ctx := context.Background()
+
+		token, err := oauth.Token(ctx)
+		xt.OK(t, err)
+		xt.Eq(t, "token-1-", token)
+
+		token, err = oauth.Token(ctx)
+		xt.OK(t, err)
+		xt.Eq(t, "token-2-", token, "expires within 30 seconds, so refreshed")
+
+		atomic.StoreInt32(&failing, 1)
+		defer atomic.StoreInt32(&failing, 0)
+		token, err = oauth.Token(ctx)
+		xt.OK(t, err)
+		xt.Eq(t, "token-2-", token, "refresh failed, but token still valid")
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		oauth := &OAuth2ClientCredentials{TokenURL: tokenServer.URL, ClientID: "svc", ClientSecret: "wrong"}
+		_, err := NewClient(server.URL, WithAuthenticator(oauth)).Get()
+		xt.KO(t, err)
+		xt.Assert(t, strings.Contains(err.Error(), "invalid_client"), err.Error())
+	})
+}
+
+func TestHMACSigner(t *testing.T) {
+	server := echoAuthServer()
+	defer server.Close()
+
+	signer := &HMACSigner{
+		KeyID:  "key-1",
+		Secret: []byte("s3cret"),
+		now:    func() time.Time { return time.Unix(1651399200, 0) },
+	}
+	c := NewClient(server.URL, WithAuthenticator(signer), WithRetry(RetryPolicy{}))
+
+	var got map[string]string
+	_, err := c.NewRequest(context.Background(), http.MethodPut, "items/1").
+		Query("v", "2").
+		JSON(map[string]int{"count": 3}).
+		Do(&got)
+	xt.OK(t, err)
+
+	sig := HMACSignature([]byte("s3cret"), http.MethodPut, "/items/1?v=2", "1651399200", []byte(`{"count":3}`))
+	xt.Eq(t, "HMAC-SHA256 Credential=key-1, Timestamp=1651399200, Signature="+sig, got["authorization"])
+	xt.Eq(t, `{"count":3}`, got["body"], "body must still be sent")
+}
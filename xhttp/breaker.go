@@ -0,0 +1,311 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerMinRequests      = 10
+	defaultBreakerWindow           = time.Minute
+	defaultBreakerOpenTimeout      = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// ErrCircuitOpen is returned by Client, without making the request, when
+// the circuit breaker of the host is open. Use errors.Is to check for it;
+// the error returned is *CircuitOpenError.
+var ErrCircuitOpen = errors.New("xhttp: circuit open")
+
+// CircuitOpenError is the error returned when the circuit breaker of
+// Host is open.
+type CircuitOpenError struct {
+	Host string
+	// RetryIn is how long until the breaker lets a probe request through.
+	// It is zero when the breaker is half-open and already probing.
+	RetryIn time.Duration
+}
+
+// Error returns the error as string.
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("xhttp: circuit open for %s", e.Host)
+}
+
+// Is returns whether target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests immediately with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through.
+	// When they succeed, the circuit closes; otherwise it opens again.
+	CircuitHalfOpen
+)
+
+// String returns the name of s.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerPolicy configures the circuit breaker of Client. Each host
+// has its own breaker. Zero values are replaced with defaults.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures after which
+	// the circuit opens. Defaults to 5.
+	FailureThreshold int
+
+	// FailureRate is the fraction, between 0 and 1, of failed requests
+	// within Window after which the circuit opens. It is only used when
+	// larger than 0, and when at least MinRequests were made within
+	// Window.
+	FailureRate float64
+
+	// MinRequests is the minimum number of requests within Window before
+	// FailureRate is considered. Defaults to 10.
+	MinRequests int
+
+	// Window is the period over which the failure rate is calculated.
+	// Defaults to 1 minute.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before probe
+	// requests are let through. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probe requests let through while
+	// half-open. Defaults to 1.
+	HalfOpenRequests int
+
+	// IsFailure returns whether the request which resulted in resp or err
+	// failed. Defaults to failing when err is not nil, except when the
+	// context was canceled, or when the server replied with an HTTP
+	// status code of 500 or higher.
+	IsFailure func(resp *http.Response, err error) bool
+
+	// OnStateChange, when set, is called when the circuit of host changes
+	// from state from to state to. It is called from the goroutine making
+	// the request, and must not block.
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+func (p CircuitBreakerPolicy) withDefaults() CircuitBreakerPolicy {
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if p.MinRequests <= 0 {
+		p.MinRequests = defaultBreakerMinRequests
+	}
+	if p.Window <= 0 {
+		p.Window = defaultBreakerWindow
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if p.HalfOpenRequests <= 0 {
+		p.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+	if p.IsFailure == nil {
+		p.IsFailure = isBreakerFailure
+	}
+	return p
+}
+
+// isBreakerFailure is the default of CircuitBreakerPolicy.IsFailure.
+func isBreakerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= 500
+}
+
+// WithCircuitBreaker is a functional option for xhttp.NewClient failing
+// requests immediately with ErrCircuitOpen when their host is failing,
+// instead of waiting for it to time out. Each attempt made by the retry
+// policy counts as a request; retries stop when the circuit opens.
+//
+// For example, logging state changes:
+//
+//     c := xhttp.NewClient(uri, xhttp.WithCircuitBreaker(xhttp.CircuitBreakerPolicy{
+//         FailureRate: 0.5,
+//         OnStateChange: func(host string, from, to xhttp.CircuitState) {
+//             log.WithFields(xlog.Fields{"host": host, "from": from, "to": to}).
+//                 Warn("circuit breaker changed state")
+//         },
+//     }))
+func WithCircuitBreaker(policy CircuitBreakerPolicy) ClientOption {
+	return func(options *clientOptions) {
+		options.CircuitBreaker = newCircuitBreaker(policy)
+	}
+}
+
+// circuitBreaker keeps a circuit for each host.
+type circuitBreaker struct {
+	policy CircuitBreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of the circuit breaker of a single host.
+type circuit struct {
+	state       CircuitState
+	openedAt    time.Time
+	consecutive int // consecutive failures
+	windowStart time.Time
+	requests    int // within window
+	failures    int // within window
+	probes      int // while half-open
+}
+
+func newCircuitBreaker(policy CircuitBreakerPolicy) *circuitBreaker {
+	return &circuitBreaker{
+		policy:   policy.withDefaults(),
+		now:      time.Now,
+		circuits: map[string]*circuit{},
+	}
+}
+
+// stateChange is a change of state to report after unlocking.
+type stateChange struct {
+	host     string
+	from, to CircuitState
+}
+
+func (cb *circuitBreaker) report(changes ...stateChange) {
+	if cb.policy.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		if c.from != c.to {
+			cb.policy.OnStateChange(c.host, c.from, c.to)
+		}
+	}
+}
+
+// allow returns whether a request to host can be made. When it can, the
+// returned function must be called with the outcome of the request.
+func (cb *circuitBreaker) allow(host string) (func(failed bool), error) {
+	cb.mu.Lock()
+
+	c, ok := cb.circuits[host]
+	if !ok {
+		c = &circuit{windowStart: cb.now()}
+		cb.circuits[host] = c
+	}
+
+	var change stateChange
+	if c.state == CircuitOpen {
+		elapsed := cb.now().Sub(c.openedAt)
+		if elapsed < cb.policy.OpenTimeout {
+			cb.mu.Unlock()
+			return nil, &CircuitOpenError{Host: host, RetryIn: cb.policy.OpenTimeout - elapsed}
+		}
+		change = stateChange{host: host, from: CircuitOpen, to: CircuitHalfOpen}
+		c.state = CircuitHalfOpen
+		c.probes = 0
+	}
+
+	if c.state == CircuitHalfOpen {
+		if c.probes >= cb.policy.HalfOpenRequests {
+			cb.mu.Unlock()
+			cb.report(change)
+			return nil, &CircuitOpenError{Host: host}
+		}
+		c.probes++
+	}
+
+	cb.mu.Unlock()
+	cb.report(change)
+
+	return func(failed bool) { cb.done(host, failed) }, nil
+}
+
+// done records the outcome of a request to host.
+func (cb *circuitBreaker) done(host string, failed bool) {
+	cb.mu.Lock()
+
+	c := cb.circuits[host]
+	now := cb.now()
+	change := stateChange{host: host, from: c.state, to: c.state}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			cb.open(c, now)
+		} else {
+			c.state = CircuitClosed
+			c.consecutive = 0
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+	case CircuitClosed:
+		if now.Sub(c.windowStart) >= cb.policy.Window {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+			c.consecutive++
+		} else {
+			c.consecutive = 0
+		}
+
+		p := cb.policy
+		if c.consecutive >= p.FailureThreshold ||
+			(p.FailureRate > 0 && c.requests >= p.MinRequests &&
+				float64(c.failures)/float64(c.requests) >= p.FailureRate) {
+			cb.open(c, now)
+		}
+	}
+	// when open, another request already opened the circuit
+
+	change.to = c.state
+	cb.mu.Unlock()
+	cb.report(change)
+}
+
+// open opens circuit c at now.
+func (cb *circuitBreaker) open(c *circuit, now time.Time) {
+	c.state = CircuitOpen
+	c.openedAt = now
+	c.consecutive = 0
+	c.requests, c.failures = 0, 0
+	c.probes = 0
+}
+
+// roundTrip sends req using rt when the circuit of the host of req
+// allows it.
+func (cb *circuitBreaker) roundTrip(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	done, err := cb.allow(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rt.RoundTrip(req)
+	done(cb.policy.IsFailure(resp, err))
+	return resp, err
+}
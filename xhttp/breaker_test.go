@@ -0,0 +1,146 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	var failing int32 = 1
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var changes []string
+	c := NewClient(srv.URL, WithCircuitBreaker(CircuitBreakerPolicy{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		OnStateChange: func(host string, from, to CircuitState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	}))
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get()
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	_, err := c.Get()
+	xt.KO(t, err)
+	xt.Assert(t, errors.Is(err, ErrCircuitOpen), err.Error())
+	var errOpen *CircuitOpenError
+	xt.Assert(t, errors.As(err, &errOpen))
+	xt.Eq(t, srv.Listener.Addr().String(), errOpen.Host)
+	xt.Eq(t, int32(2), atomic.LoadInt32(&count), "request made while open")
+
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&failing, 0)
+	resp, err := c.Get()
+	xt.OK(t, err)
+	_ = resp.Body.Close()
+	xt.Eq(t, http.StatusNoContent, resp.StatusCode)
+
+	xt.Eq(t, []string{"closed>open", "open>half-open", "half-open>closed"}, changes)
+}
+
+func TestWithCircuitBreaker_retry(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL,
+		WithRetry(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}),
+		WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 2}))
+
+	_, err := c.Get()
+	xt.KO(t, err)
+	xt.Assert(t, errors.Is(err, ErrCircuitOpen))
+	xt.Eq(t, int32(2), atomic.LoadInt32(&count), "retries stop when circuit opens")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	newBreaker := func(p CircuitBreakerPolicy) *circuitBreaker {
+		cb := newCircuitBreaker(p)
+		cb.now = func() time.Time { return now }
+		return cb
+	}
+
+	request := func(cb *circuitBreaker, host string, failed bool) error {
+		done, err := cb.allow(host)
+		if err != nil {
+			return err
+		}
+		done(failed)
+		return nil
+	}
+
+	t.Run("failure rate within window", func(t *testing.T) {
+		cb := newBreaker(CircuitBreakerPolicy{
+			FailureThreshold: 100,
+			FailureRate:      0.5,
+			MinRequests:      4,
+			Window:           time.Minute,
+		})
+
+		for _, failed := range []bool{true, false, true} {
+			xt.OK(t, request(cb, "a", failed))
+		}
+		xt.Eq(t, CircuitClosed, cb.circuits["a"].state, "below minimum requests")
+
+		xt.OK(t, request(cb, "a", false))
+		xt.Eq(t, CircuitOpen, cb.circuits["a"].state)
+		xt.OK(t, request(cb, "b", false), "hosts have their own circuit")
+
+		now = now.Add(time.Hour)
+		xt.OK(t, request(cb, "a", false))
+		xt.Eq(t, CircuitClosed, cb.circuits["a"].state)
+
+		for _, failed := range []bool{true, true, false} {
+			xt.OK(t, request(cb, "a", failed))
+		}
+		now = now.Add(2 * time.Minute)
+		xt.OK(t, request(cb, "a", true))
+		xt.Eq(t, CircuitClosed, cb.circuits["a"].state, "window was reset")
+	})
+
+	t.Run("half-open probes", func(t *testing.T) {
+		cb := newBreaker(CircuitBreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Second})
+
+		xt.OK(t, request(cb, "a", true))
+		err := request(cb, "a", false)
+		xt.Assert(t, errors.Is(err, ErrCircuitOpen))
+		xt.Eq(t, time.Second, err.(*CircuitOpenError).RetryIn)
+
+		now = now.Add(time.Second)
+		done, err := cb.allow("a")
+		xt.OK(t, err)
+		xt.Eq(t, CircuitHalfOpen, cb.circuits["a"].state)
+
+		_, err = cb.allow("a")
+		xt.Assert(t, errors.Is(err, ErrCircuitOpen), "only one probe")
+
+		done(true)
+		xt.Eq(t, CircuitOpen, cb.circuits["a"].state, "failed probe opens circuit")
+	})
+}
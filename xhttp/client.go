@@ -3,7 +3,6 @@
 package xhttp
 
 import (
-	"crypto/tls"
 	"io"
 	"net/http"
 )
@@ -29,13 +28,18 @@ func NewClient(uri string, options ...ClientOption) *Client {
 		Client: &http.Client{
 			Transport: &transport{
 				trp: http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: opt.TLSInsecureSkipVerify,
-					},
+					TLSClientConfig: opt.tlsConfig(),
 				},
 				bearer:                opt.AuthBearer,
 				contentType:           opt.getContentType(),
 				tlsInsecureSkipVerify: opt.TLSInsecureSkipVerify,
+				retry:                 opt.Retry,
+				auth:                  opt.Authenticator,
+				err:                   opt.err,
+				logger:                opt.Logger,
+				tracer:                opt.Tracer,
+				base:                  opt.RoundTripper,
+				breaker:               opt.CircuitBreaker,
 			},
 			Timeout: opt.Timeout,
 		},
@@ -4,11 +4,21 @@ package xhttp
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/geertjanvdk/xkit/xt"
 )
@@ -38,7 +48,7 @@ func TestNewClient(t *testing.T) {
 		body, err := ioutil.ReadAll(resp.Body)
 		xt.OK(t, err)
 		xt.Eq(t, `"hello!"`, string(body))
-		xt.Eq(t, defaultContentType, resp.Header.Get(HeaderContentType))
+		xt.Eq(t, "", resp.Header.Get(HeaderContentType), "request without body has no content type")
 	})
 
 	t.Run("method POST", func(t *testing.T) {
@@ -83,6 +93,36 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+func TestClient_Do(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handlerPostEcho))
+	defer server.Close()
+
+	t.Run("content type of request is kept", func(t *testing.T) {
+		c := NewClient(server.URL, WithBearer("client.bearer"))
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte("a,b")))
+		xt.OK(t, err)
+		req.Header.Set(HeaderContentType, "text/csv")
+		req.Header.Set(HeaderAuthorization, "Bearer request.bearer")
+
+		resp, err := c.Do(req)
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, "text/csv", resp.Header.Get(HeaderContentType))
+	})
+
+	t.Run("request is not modified", func(t *testing.T) {
+		c := NewClient(server.URL, WithBearer("client.bearer"))
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte("{}")))
+		xt.OK(t, err)
+
+		resp, err := c.Do(req)
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, defaultContentType, resp.Header.Get(HeaderContentType))
+		xt.Eq(t, 0, len(req.Header))
+	})
+}
+
 func TestClient_AuthBearer(t *testing.T) {
 	c := NewClient("http://127.0.0.1")
 	exp := "this.is.my.authorization.bearer"
@@ -90,6 +130,86 @@ func TestClient_AuthBearer(t *testing.T) {
 	xt.Eq(t, exp, c.AuthzBearer())
 }
 
+func TestNewClient_TLS(t *testing.T) {
+	clientCert := testClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MaxVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		c := NewClient(server.URL, WithTLSRootCAPEM(serverCA), WithTLSClientCertificate(clientCert))
+		resp, err := c.Get()
+		xt.OK(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		xt.OK(t, err)
+		xt.Eq(t, "xkit-client", string(body))
+	})
+
+	t.Run("client certificate required", func(t *testing.T) {
+		c := NewClient(server.URL, WithTLSRootCAPEM(serverCA))
+		_, err := c.Get()
+		xt.KO(t, err)
+	})
+
+	t.Run("minimum TLS version", func(t *testing.T) {
+		c := NewClient(server.URL, WithTLSRootCAPEM(serverCA), WithTLSClientCertificate(clientCert),
+			WithTLSMinVersion(tls.VersionTLS13))
+		_, err := c.Get()
+		xt.KO(t, err)
+		xt.Match(t, ".*protocol version.*", err.Error())
+	})
+
+	t.Run("invalid root CA", func(t *testing.T) {
+		c := NewClient(server.URL, WithTLSRootCAPEM([]byte("not a certificate")))
+		_, err := c.Get()
+		xt.KO(t, err)
+		xt.Match(t, ".*no certificates found in root CA PEM", err.Error())
+
+		c = NewClient(server.URL, WithTLSRootCAFile(filepath.Join(t.TempDir(), "missing.pem")))
+		_, err = c.Get()
+		xt.KO(t, err)
+		xt.Match(t, ".*reading root CA file.*", err.Error())
+	})
+}
+
+// testClientCertificate returns a self-signed certificate usable for
+// client authentication.
+func testClientCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	xt.OK(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "xkit-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	xt.OK(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	xt.OK(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
 func handlerGetHello(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(HeaderContentType, r.Header.Get(HeaderContentType))
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,336 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const defaultCompressMinSize = 1024
+
+// defaultCompressSkip are the content types which are already compressed.
+// Entries ending with a `/` match the complete type.
+var defaultCompressSkip = []string{
+	"image/", "audio/", "video/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-bzip2", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/x-xz", "application/zstd",
+	"application/pdf", "application/wasm",
+}
+
+// CompressOptions configures the middleware returned by Compress.
+type CompressOptions struct {
+	// MinSize is the minimum size in bytes of the response body before
+	// it is compressed. Defaults to 1024.
+	MinSize int
+
+	// Level is the compression level; see compress/flate. Defaults to
+	// flate.DefaultCompression, which is also used when Level is 0, so
+	// flate.NoCompression (0) can not be selected; to not compress, do
+	// not use the middleware.
+	Level int
+
+	// Skip lists content types which are not compressed. Entries ending
+	// with `/`, like `image/`, match the complete type. Defaults to
+	// content types which are already compressed, like images and archives,
+	// but SVG images are always compressed.
+	Skip []string
+}
+
+// Compress returns middleware compressing responses using gzip or deflate,
+// depending on the HTTP Accept-Encoding header of the request. Responses
+// smaller than the minimum size, responses which already have a content
+// encoding, and responses with content types which are already compressed
+// are not compressed. The HTTP Vary header always includes
+// Accept-Encoding.
+//
+// The http.ResponseWriter passed to handlers supports http.Flusher and,
+// when the underlying writer does, http.Hijacker.
+func Compress(opts CompressOptions) Middleware {
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	if opts.Level == 0 {
+		opts.Level = flate.DefaultCompression
+	}
+	if opts.Skip == nil {
+		opts.Skip = defaultCompressSkip
+	}
+
+	if _, err := flate.NewWriter(io.Discard, opts.Level); err != nil {
+		panic("xhttp: invalid compression level; " + err.Error())
+	}
+
+	c := &compressor{opts: opts}
+	c.gzipPool.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, opts.Level)
+		return w
+	}
+	c.flatePool.New = func() interface{} {
+		w, _ := flate.NewWriter(io.Discard, opts.Level)
+		return w
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				c:              c,
+				encoding:       encoding,
+			}
+			defer func() { _ = cw.close() }()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+type compressor struct {
+	opts      CompressOptions
+	gzipPool  sync.Pool
+	flatePool sync.Pool
+}
+
+// skip returns whether contentType must not be compressed.
+func (c *compressor) skip(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if mediaType == "image/svg+xml" {
+		return false
+	}
+
+	for _, s := range c.opts.Skip {
+		if mediaType == s || (strings.HasSuffix(s, "/") && strings.HasPrefix(mediaType, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the compression to use for the value of the
+// Accept-Encoding header. Returns an empty string when not compressing.
+func negotiateEncoding(header string) string {
+	for _, enc := range []string{"gzip", "deflate"} {
+		if acceptsEncoding(header, enc) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressWriter buffers the response until it knows whether it needs
+// to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status    int
+	buf       []byte
+	decided   bool
+	hijacked  bool
+	cw        io.WriteCloser // nil when not compressing
+	putToPool func()
+}
+
+// WriteHeader records the status code. It is sent when the response is
+// known to be compressed or not.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	w.status = code
+}
+
+// Write writes data to the compressor, or to the underlying
+// http.ResponseWriter when the response is not compressed.
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.c.opts.MinSize {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if w.cw != nil {
+		return w.cw.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide sets up compression, when possible and bigEnough, and writes
+// the headers and buffered data.
+func (w *compressWriter) decide(bigEnough bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	hdr := w.ResponseWriter.Header()
+	if hdr.Get(HeaderContentType) == "" && len(w.buf) > 0 {
+		hdr.Set(HeaderContentType, http.DetectContentType(w.buf))
+	}
+
+	compress := bigEnough &&
+		hdr.Get("Content-Encoding") == "" &&
+		hdr.Get("Content-Range") == "" &&
+		bodyAllowedForStatus(w.status) &&
+		w.status != http.StatusPartialContent &&
+		!w.c.skip(hdr.Get(HeaderContentType))
+
+	if compress {
+		hdr.Set("Content-Encoding", w.encoding)
+		hdr.Del("Content-Length")
+
+		switch w.encoding {
+		case "gzip":
+			gz := w.c.gzipPool.Get().(*gzip.Writer)
+			gz.Reset(w.ResponseWriter)
+			w.cw = gz
+			w.putToPool = func() { w.c.gzipPool.Put(gz) }
+		default:
+			fl := w.c.flatePool.Get().(*flate.Writer)
+			fl.Reset(w.ResponseWriter)
+			w.cw = fl
+			w.putToPool = func() { w.c.flatePool.Put(fl) }
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if w.cw != nil {
+		_, err := w.cw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush implements the http.Flusher interface. Data written so far is
+// compressed, regardless of its size, and flushed to the client.
+func (w *compressWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		_ = w.decide(true)
+	}
+
+	if fl, ok := w.cw.(interface{ Flush() error }); ok {
+		_ = fl.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface when the underlying
+// http.ResponseWriter supports it.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("xhttp: response writer does not support hijacking")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close writes what is buffered and finishes compressing.
+func (w *compressWriter) close() error {
+	if w.hijacked {
+		return nil
+	}
+
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// handler wrote nothing; let net/http write the default
+			return nil
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if w.cw == nil {
+		return nil
+	}
+
+	err := w.cw.Close()
+	w.putToPool()
+	w.cw = nil
+	return err
+}
+
+// addVary adds value to the HTTP Vary header of h, unless already present.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// bodyAllowedForStatus reports whether a given response status code
+// permits a body. See RFC 7230, section 3.3.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
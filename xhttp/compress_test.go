@@ -0,0 +1,133 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"xkit"},`, 200)
+
+	serve := func(h http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		Compress(CompressOptions{})(h).ServeHTTP(rr, req)
+		return rr
+	}
+
+	jsonHandler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(HeaderContentType, ContentTypeJSON)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(body))
+		}
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		rr := serve(jsonHandler(large), "deflate, gzip")
+		xt.Eq(t, http.StatusCreated, rr.Code)
+		xt.Eq(t, "gzip", rr.Header().Get("Content-Encoding"))
+		xt.Eq(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		xt.Assert(t, rr.Body.Len() < len(large))
+
+		gz, err := gzip.NewReader(rr.Body)
+		xt.OK(t, err)
+		body, err := ioutil.ReadAll(gz)
+		xt.OK(t, err)
+		xt.Eq(t, large, string(body))
+	})
+
+	t.Run("deflate", func(t *testing.T) {
+		rr := serve(jsonHandler(large), "deflate")
+		xt.Eq(t, "deflate", rr.Header().Get("Content-Encoding"))
+
+		body, err := ioutil.ReadAll(flate.NewReader(rr.Body))
+		xt.OK(t, err)
+		xt.Eq(t, large, string(body))
+	})
+
+	t.Run("not accepted", func(t *testing.T) {
+		rr := serve(jsonHandler(large), "gzip;q=0")
+		xt.Eq(t, "", rr.Header().Get("Content-Encoding"))
+		xt.Eq(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		xt.Eq(t, large, rr.Body.String())
+	})
+
+	t.Run("small bodies are not compressed", func(t *testing.T) {
+		rr := serve(jsonHandler(`{"small":true}`), "gzip")
+		xt.Eq(t, http.StatusCreated, rr.Code)
+		xt.Eq(t, "", rr.Header().Get("Content-Encoding"))
+		xt.Eq(t, `{"small":true}`, rr.Body.String())
+	})
+
+	t.Run("compressed content types are skipped", func(t *testing.T) {
+		rr := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(HeaderContentType, "image/png")
+			_, _ = w.Write([]byte(large))
+		}, "gzip")
+		xt.Eq(t, "", rr.Header().Get("Content-Encoding"))
+		xt.Eq(t, large, rr.Body.String())
+	})
+
+	t.Run("flush compresses what is written", func(t *testing.T) {
+		rr := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(HeaderContentType, "text/event-stream")
+			_, _ = w.Write([]byte("data: 1\n\n"))
+			w.(http.Flusher).Flush()
+			xt.Assert(t, recorderOf(w).Flushed)
+			_, _ = w.Write([]byte("data: 2\n\n"))
+		}, "gzip")
+		xt.Eq(t, "gzip", rr.Header().Get("Content-Encoding"))
+
+		gz, err := gzip.NewReader(rr.Body)
+		xt.OK(t, err)
+		body, err := ioutil.ReadAll(gz)
+		xt.OK(t, err)
+		xt.Eq(t, "data: 1\n\ndata: 2\n\n", string(body))
+	})
+
+	t.Run("hijack", func(t *testing.T) {
+		var hijacked bool
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		hw := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+		Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _, err := w.(http.Hijacker).Hijack()
+			xt.OK(t, err)
+			hijacked = true
+		})).ServeHTTP(hw, req)
+
+		xt.Assert(t, hijacked)
+		xt.Assert(t, hw.hijacked)
+	})
+}
+
+// recorderOf returns the httptest.ResponseRecorder wrapped by the compressing writer w.
+func recorderOf(w http.ResponseWriter) *httptest.ResponseRecorder {
+	return w.(*compressWriter).ResponseWriter.(*httptest.ResponseRecorder)
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
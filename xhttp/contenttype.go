@@ -8,4 +8,8 @@ const (
 	ContentTypeHTML   = "text/html; charset=utf-8"
 	ContentTypeJSON   = "application/json; charset=utf-8"
 	ContentTypeBinary = "application/octet-stream"
+	ContentTypeForm   = "application/x-www-form-urlencoded"
+	ContentTypeSSE    = "text/event-stream"
+
+	ContentTypeProblemJSON = "application/problem+json; charset=utf-8"
 )
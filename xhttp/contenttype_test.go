@@ -13,4 +13,7 @@ func TestContentTypes(t *testing.T) {
 	xt.Eq(t, "text/html; charset=utf-8", ContentTypeHTML)
 	xt.Eq(t, "application/json; charset=utf-8", ContentTypeJSON)
 	xt.Eq(t, "application/octet-stream", ContentTypeBinary)
+	xt.Eq(t, "application/x-www-form-urlencoded", ContentTypeForm)
+	xt.Eq(t, "text/event-stream", ContentTypeSSE)
+	xt.Eq(t, "application/problem+json; charset=utf-8", ContentTypeProblemJSON)
 }
@@ -21,4 +21,10 @@ var (
 	// within the request the captured values in the path when matching
 	// URLs using ServeReMux.
 	CapturesContextKey = &contextKey{name: "xhttp.ServeReMux.Captures"}
+
+	// AllowedMethodsContextKey is a context key which is used to register
+	// within the request the methods allowed by the patterns matching the
+	// path when ServeReMux did not allow the method of the request. Its
+	// associated type is []Method.
+	AllowedMethodsContextKey = &contextKey{name: "xhttp.ServeReMux.AllowedMethods"}
 )
@@ -0,0 +1,194 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []Method{MethodGet, MethodHead, MethodPost}
+	defaultCORSHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", "Authorization"}
+)
+
+// CORSOptions configures the middleware returned by CORS.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins which are allowed to make
+	// cross-origin requests. An origin can contain one wildcard, for
+	// example `https://*.example.com`. The origin `*` allows all.
+	AllowedOrigins []string
+
+	// AllowedMethods lists the methods which can be used for cross-origin
+	// requests. Defaults to GET, HEAD and POST. When used with ServeReMux,
+	// only the methods which are also allowed by the matching route are
+	// reported when answering preflight requests.
+	AllowedMethods []Method
+
+	// AllowedHeaders lists the request headers which can be used with
+	// cross-origin requests. When it contains `*`, all requested headers
+	// are allowed. Defaults to Accept, Accept-Language, Content-Language,
+	// Content-Type, and Authorization.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers which can be read by the
+	// client.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests to include credentials like
+	// cookies. The origin of the request is then returned instead of `*`.
+	// It can not be combined with the origin `*`, as any site could then
+	// make requests using the credentials of the user; CORS panics when
+	// both are set.
+	AllowCredentials bool
+
+	// MaxAge is how long the result of a preflight request can be cached.
+	MaxAge time.Duration
+}
+
+// CORS returns middleware handling Cross-Origin Resource Sharing (CORS).
+// Preflight requests, which use the OPTIONS method, are answered by the
+// middleware with HTTP status 204 and are not passed on to the next
+// handler. Requests from origins which are not allowed are passed on
+// without CORS headers; preflight requests of these origins are answered
+// with HTTP status 403.
+//
+// When used with ServeReMux, preflight requests are answered only for
+// paths matching a route, and report the methods allowed by that route:
+//
+//     mux.Use(xhttp.CORS(xhttp.CORSOptions{
+//         AllowedOrigins: []string{"https://*.example.com"},
+//         AllowedMethods: []xhttp.Method{xhttp.MethodGet, xhttp.MethodPost},
+//     }))
+//
+// Panics when AllowCredentials is used together with the origin `*`.
+func CORS(opts CORSOptions) Middleware {
+	if opts.AllowCredentials && hasStringFold(opts.AllowedOrigins, "*") {
+		panic("xhttp: CORS can not allow credentials for all origins (`*`)")
+	}
+	if opts.AllowedMethods == nil {
+		opts.AllowedMethods = defaultCORSMethods
+	}
+	if opts.AllowedHeaders == nil {
+		opts.AllowedHeaders = defaultCORSHeaders
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addVary(w.Header(), "Origin")
+			if preflight {
+				addVary(w.Header(), "Access-Control-Request-Method")
+				addVary(w.Header(), "Access-Control-Request-Headers")
+			}
+
+			if !opts.originAllowed(origin) {
+				if preflight {
+					Error(w, r, http.StatusForbidden, "403 origin not allowed", nil)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			methods := opts.AllowedMethods
+			if preflight {
+				ctx := r.Context()
+				routeMethods, notAllowed := ctx.Value(AllowedMethodsContextKey).([]Method)
+				pattern, routed := ctx.Value(RegexpMatchContextKey).(string)
+
+				switch {
+				case notAllowed:
+					methods = nil
+					for _, m := range opts.AllowedMethods {
+						if hasMethod(routeMethods, m) {
+							methods = append(methods, m)
+						}
+					}
+				case routed && pattern == "":
+					// ServeReMux found no route; let it reply with 404
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			hdr := w.Header()
+			if !hasStringFold(opts.AllowedOrigins, "*") {
+				hdr.Set("Access-Control-Allow-Origin", origin)
+			} else {
+				hdr.Set("Access-Control-Allow-Origin", "*")
+			}
+			if opts.AllowCredentials {
+				hdr.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(opts.ExposedHeaders) > 0 {
+					hdr.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hdr.Set("Access-Control-Allow-Methods", joinMethods(methods))
+
+			if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				if hasStringFold(opts.AllowedHeaders, "*") {
+					hdr.Set("Access-Control-Allow-Headers", reqHeaders)
+				} else {
+					hdr.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+				}
+			}
+
+			if opts.MaxAge > 0 {
+				hdr.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// originAllowed returns whether origin is allowed.
+func (opts CORSOptions) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, allowed := range opts.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		i := strings.IndexByte(allowed, '*')
+		if i == -1 {
+			continue
+		}
+		prefix, suffix := allowed[:i], allowed[i+1:]
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasStringFold returns whether a contains x. Unlike xutil.HasString, the
+// comparison is case-insensitive.
+func hasStringFold(a []string, x string) bool {
+	for _, s := range a {
+		if strings.EqualFold(s, x) {
+			return true
+		}
+	}
+	return false
+}
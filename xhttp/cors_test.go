@@ -0,0 +1,102 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestCORS(t *testing.T) {
+	mux := NewServeReMux()
+	mux.Use(CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com", "http://localhost:3000"},
+		AllowedMethods:   []Method{MethodGet, MethodPost, MethodDelete},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	mux.Handle(`^/persons$`, pathEchoHandler{}, MethodGet, MethodPost)
+
+	serve := func(method, p string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, p, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("preflight reports methods allowed by route", func(t *testing.T) {
+		rr := serve(http.MethodOptions, "/persons", map[string]string{
+			"Origin":                         "https://app.example.com",
+			"Access-Control-Request-Method":  "POST",
+			"Access-Control-Request-Headers": "content-type",
+		})
+		xt.Eq(t, http.StatusNoContent, rr.Code)
+		xt.Eq(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+		xt.Eq(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+		xt.Eq(t, "GET, POST", rr.Header().Get("Access-Control-Allow-Methods"))
+		xt.Eq(t, "Accept, Accept-Language, Content-Language, Content-Type, Authorization",
+			rr.Header().Get("Access-Control-Allow-Headers"))
+		xt.Eq(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("preflight for unknown path", func(t *testing.T) {
+		rr := serve(http.MethodOptions, "/nope", map[string]string{
+			"Origin":                        "https://app.example.com",
+			"Access-Control-Request-Method": "GET",
+		})
+		xt.Eq(t, http.StatusNotFound, rr.Code)
+		xt.Eq(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("origin not allowed", func(t *testing.T) {
+		rr := serve(http.MethodOptions, "/persons", map[string]string{
+			"Origin":                        "https://example.org",
+			"Access-Control-Request-Method": "GET",
+		})
+		xt.Eq(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(http.MethodGet, "/persons", map[string]string{"Origin": "https://example.org"})
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "", rr.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("actual request", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/persons", map[string]string{"Origin": "http://localhost:3000"})
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "http://localhost:3000", rr.Header().Get("Access-Control-Allow-Origin"))
+		xt.Eq(t, "X-Request-Id", rr.Header().Get("Access-Control-Expose-Headers"))
+		xt.Eq(t, "Origin", rr.Header().Get("Vary"))
+	})
+
+	t.Run("any origin without credentials", func(t *testing.T) {
+		h := CORS(CORSOptions{AllowedOrigins: []string{"*"}})(pathEchoHandler{})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://example.org")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		xt.Eq(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("any origin with credentials panics", func(t *testing.T) {
+		xt.Panics(t, func() {
+			CORS(CORSOptions{AllowedOrigins: []string{"https://example.com", "*"}, AllowCredentials: true})
+		})
+	})
+}
+
+func TestCORSOptions_originAllowed(t *testing.T) {
+	opts := CORSOptions{AllowedOrigins: []string{"https://*.example.com"}}
+	xt.Assert(t, opts.originAllowed("https://app.example.com"))
+	xt.Assert(t, opts.originAllowed("https://A.B.Example.com"))
+	xt.Assert(t, !opts.originAllowed("https://example.com"))
+	xt.Assert(t, !opts.originAllowed("http://app.example.com"))
+	xt.Assert(t, !opts.originAllowed("https://app.example.com.evil.io"))
+}
@@ -21,6 +21,39 @@ The following functional options are available:
 
 - WithTLSInsecure()
 - WithBearer(string)
+- WithRetry(RetryPolicy)
+- WithAuthenticator(Authenticator)
+- WithTLSRootCAFile(string) and WithTLSRootCAPEM([]byte)
+- WithTLSClientCertificate(tls.Certificate) and WithTLSClientCertificateFiles(string, string)
+- WithTLSMinVersion(uint16)
+- WithTLSServerName(string)
+- WithRequestLogger(*xlog.Logger)
+- WithTracer(ClientTracer)
+- WithRoundTripper(http.RoundTripper)
+- WithCircuitBreaker(CircuitBreakerPolicy)
+
+Requests with a context, query parameters, headers or a JSON body are built
+using NewRequest, resolving the path against the URI of the client:
+
+	var user User
+	_, err := c.NewRequest(ctx, http.MethodGet, "users/1234").
+		Query("fields", "name").
+		Do(&user)
+
+When the server replies with a status code which is not 2xx, the error is
+a *StatusError holding the response body.
+
+### Server-Sent Events
+
+Handlers stream events to browsers using NewSSEWriter, which also sends
+heartbeats. Clients read them using Client.NewSSEReader, which reconnects
+sending the Last-Event-ID header.
+
+### WebSockets
+
+WebSocketHandler upgrades requests to WebSocket connections, and
+Client.DialWebSocket connects to them. Both read and write complete
+messages, and handle ping, pong, and close frames.
 
 */
 package xhttp
@@ -5,76 +5,145 @@ package xhttp
 import (
 	"encoding/json"
 	"fmt"
+	"html"
+	"mime"
 	"net/http"
-	"strconv"
+	"sort"
 	"strings"
-
-	"github.com/geertjanvdk/xkit/xutil"
 )
 
-func writeError(w http.ResponseWriter, contentType string, code int, msg string) {
-	contentType = strings.TrimSpace(contentType)
-	if contentType == "" {
-		contentType = ContentTypePlain
+// errorContentTypes are the content types Error can respond with. When
+// equally acceptable, plain text is preferred.
+var errorContentTypes = []string{
+	ContentTypePlain,
+	ContentTypeHTML,
+	ContentTypeJSON,
+	ContentTypeProblemJSON,
+}
+
+// problem is the RFC 7807 problem details document.
+type problem struct {
+	Type    string
+	Title   string
+	Status  int
+	Detail  string
+	Details map[string]interface{}
+}
+
+// MarshalJSON implements the json.Marshaler interface. The details of p
+// are added as extension members.
+func (p problem) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{}
+	for k, v := range p.Details {
+		m[k] = v
 	}
-	if !strings.Contains(contentType, "charset") &&
-		!xutil.HasString([]string{"application/json", "text/plain", "text/html"}, contentType) {
-		contentType += "; charset=utf-8"
+
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	return json.Marshal(m)
+}
+
+// errorContentType returns the content type to use when replying to r
+// with an error. The HTTP Accept header of r is used, and when not
+// available, the content type of the request.
+func errorContentType(r *http.Request) string {
+	if r.Header.Get(HeaderAccept) != "" {
+		return NegotiateContentType(r, errorContentTypes, ContentTypePlain)
 	}
 
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+	if err != nil {
+		return ContentTypePlain
+	}
+	for _, ct := range errorContentTypes {
+		if strings.SplitN(ct, ";", 2)[0] == mediaType {
+			return ct
+		}
+	}
+	return ContentTypePlain
+}
+
+// Error replies to the request with the HTTP status code and message
+// msg. The optional details are added to the response.
+// Depending on the request's Accept header, the response is JSON
+// formatted as RFC 7807 problem details, HTML, or plain text. When
+// the request has no Accept header, its content type is used instead.
+// Details are added as extension members of the problem details.
+func Error(w http.ResponseWriter, r *http.Request, status int, msg string, details map[string]interface{}) {
+	contentType := errorContentType(r)
+
 	var payload string
 
 	switch contentType {
-	case ContentTypeJSON:
-		var doc = struct {
-			Error string `json:"error"`
-			Code  string `json:"code"`
-		}{
-			Error: msg,
-			Code:  strconv.FormatInt(http.StatusInternalServerError, 10),
-		}
-		data, _ := json.Marshal(doc)
+	case ContentTypeJSON, ContentTypeProblemJSON:
+		data, _ := json.Marshal(problem{
+			Type:    "about:blank",
+			Title:   http.StatusText(status),
+			Status:  status,
+			Detail:  msg,
+			Details: details,
+		})
 		payload = string(data)
 	case ContentTypeHTML:
-		payload = `<html><body><h3>` + msg + `</h3></body></html>`
+		payload = `<html><body><h3>` + html.EscapeString(msg) + `</h3>`
+		if len(details) > 0 {
+			payload += "<dl>"
+			for _, k := range sortedDetailKeys(details) {
+				payload += "<dt>" + html.EscapeString(k) + "</dt><dd>" +
+					html.EscapeString(fmt.Sprint(details[k])) + "</dd>"
+			}
+			payload += "</dl>"
+		}
+		payload += `</body></html>`
 	default:
 		payload = msg
+		for _, k := range sortedDetailKeys(details) {
+			payload += fmt.Sprintf("\n%s: %v", k, details[k])
+		}
 	}
 
-	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(HeaderContentType, contentType)
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(code)
+	w.WriteHeader(status)
 	_, _ = fmt.Fprintln(w, payload)
 }
 
+func sortedDetailKeys(details map[string]interface{}) []string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // InternalError replies to the request with a HTTP 500.
 func InternalError(w http.ResponseWriter, r *http.Request) {
-	msg := "500 internal server error"
-	contentType := strings.ToLower(r.Header.Get("Content-Type"))
-	writeError(w, contentType, http.StatusInternalServerError, msg)
+	Error(w, r, http.StatusInternalServerError, "500 internal server error", nil)
 }
 
 // MethodNotAllowed replies to the request with a HTTP 405.
 func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
-	msg := "405 method not allowed"
-	contentType := strings.ToLower(r.Header.Get("Content-Type"))
-	writeError(w, contentType, http.StatusMethodNotAllowed, msg)
+	Error(w, r, http.StatusMethodNotAllowed, "405 method not allowed", nil)
 }
 
 // MethodNotAllowedHandler returns a request handler that replies to each
 // request with a ``405 method not allowed''. Depending
-// on the request's content type, it will return either
+// on the request's Accept header, it will return either
 // JSON, HTML or default plain text.
 func MethodNotAllowedHandler() http.Handler { return http.HandlerFunc(MethodNotAllowed) }
 
+// NotFound replies to the request with a HTTP 404.
 func NotFound(w http.ResponseWriter, r *http.Request) {
-	msg := "404 page not found"
-	contentType := strings.ToLower(r.Header.Get("Content-Type"))
-	writeError(w, contentType, http.StatusNotFound, msg)
+	Error(w, r, http.StatusNotFound, "404 page not found", nil)
 }
 
 // NotFoundHandler returns a request handler that replies to each
 // request with a ``404 page not found''. Depending
-// on the request's content type, it will return either
+// on the request's Accept header, it will return either
 // JSON, HTML or default plain text.
 func NotFoundHandler() http.Handler { return http.HandlerFunc(NotFound) }
@@ -0,0 +1,87 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestError(t *testing.T) {
+	details := map[string]interface{}{"field": "email"}
+
+	t.Run("problem details as JSON", func(t *testing.T) {
+		for _, accept := range []string{"application/problem+json", "application/json"} {
+			t.Run(accept, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set(HeaderAccept, accept)
+				rr := httptest.NewRecorder()
+
+				Error(rr, req, http.StatusBadRequest, "email is not valid", details)
+
+				xt.Eq(t, http.StatusBadRequest, rr.Code)
+				xt.Assert(t, strings.HasPrefix(rr.Header().Get(HeaderContentType), accept))
+
+				var doc map[string]interface{}
+				xt.OK(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+				xt.Eq(t, map[string]interface{}{
+					"type":   "about:blank",
+					"title":  "Bad Request",
+					"status": float64(400),
+					"detail": "email is not valid",
+					"field":  "email",
+				}, doc)
+			})
+		}
+	})
+
+	t.Run("HTML is escaped", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAccept, "text/html")
+		rr := httptest.NewRecorder()
+
+		Error(rr, req, http.StatusBadRequest, "<b>bad</b>", details)
+
+		xt.Eq(t, ContentTypeHTML, rr.Header().Get(HeaderContentType))
+		xt.Eq(t, "<html><body><h3>&lt;b&gt;bad&lt;/b&gt;</h3><dl><dt>field</dt><dd>email</dd></dl></body></html>\n",
+			rr.Body.String())
+	})
+
+	t.Run("plain text by default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+
+		Error(rr, req, http.StatusBadRequest, "bad", details)
+
+		xt.Eq(t, ContentTypePlain, rr.Header().Get(HeaderContentType))
+		xt.Eq(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		xt.Eq(t, "bad\nfield: email\n", rr.Body.String())
+	})
+
+	t.Run("status code in JSON matches", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAccept, "application/json")
+		rr := httptest.NewRecorder()
+
+		NotFound(rr, req)
+
+		var doc map[string]interface{}
+		xt.OK(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+		xt.Eq(t, float64(http.StatusNotFound), doc["status"])
+	})
+
+	t.Run("content type of request when no accept header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderContentType, ContentTypeJSON)
+		rr := httptest.NewRecorder()
+
+		MethodNotAllowed(rr, req)
+
+		xt.Eq(t, ContentTypeJSON, rr.Header().Get(HeaderContentType))
+	})
+}
@@ -4,6 +4,9 @@ package xhttp
 
 // Common HTTP headers.
 var (
-	HeaderAuthorization = "Authorization"
-	HeaderContentType   = "Content-Type"
+	HeaderAccept          = "Accept"
+	HeaderAllow           = "Allow"
+	HeaderAuthorization   = "Authorization"
+	HeaderContentType     = "Content-Type"
+	HeaderWWWAuthenticate = "WWW-Authenticate"
 )
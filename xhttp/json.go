@@ -0,0 +1,168 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodySize is the maximum size in bytes of the request body
+// decoded by DecodeJSON.
+const DefaultMaxBodySize = 1 << 20 // 1 MiB
+
+// DecodeError is returned when decoding the body of a request failed. It
+// holds the HTTP status code which should be used to reply.
+type DecodeError struct {
+	Status int
+	Err    error
+}
+
+// Error returns the error as string.
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeJSON decodes the JSON body of request r into v, and validates v
+// using the `validate` struct tags (see Validate). The body can be at
+// most DefaultMaxBodySize bytes, and must not contain fields which are
+// not available in v.
+//
+// Returns *DecodeError with HTTP status 415 when the content type of
+// r is not JSON, 413 when the body is too large, 400 when the body is
+// not valid JSON, and 422 when validation failed, in which case the
+// underlying error is ValidationError. Use WriteDecodeError to reply to
+// the request.
+func DecodeJSON(r *http.Request, v interface{}) error {
+	return DecodeJSONLimit(r, v, DefaultMaxBodySize)
+}
+
+// DecodeJSONLimit is like DecodeJSON but the body of r can be at most
+// maxBytes.
+func DecodeJSONLimit(r *http.Request, v interface{}, maxBytes int64) error {
+	if ct := r.Header.Get(HeaderContentType); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || !(mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+			return &DecodeError{
+				Status: http.StatusUnsupportedMediaType,
+				Err:    fmt.Errorf("content type must be application/json; was %s", ct),
+			}
+		}
+	}
+
+	if r.Body == nil {
+		return &DecodeError{Status: http.StatusBadRequest, Err: errors.New("request body is empty")}
+	}
+
+	body := &io.LimitedReader{R: r.Body, N: maxBytes + 1}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	errTooLarge := &DecodeError{
+		Status: http.StatusRequestEntityTooLarge,
+		Err:    fmt.Errorf("request body must not be larger than %d bytes", maxBytes),
+	}
+
+	if err := dec.Decode(v); err != nil {
+		if body.N <= 0 {
+			return errTooLarge
+		}
+		return decodeJSONError(err)
+	}
+
+	more := dec.More()
+	if body.N <= 0 {
+		// the limit was reached while reading the body, even when what was
+		// read so far decoded without error
+		return errTooLarge
+	}
+	if more {
+		return &DecodeError{
+			Status: http.StatusBadRequest,
+			Err:    errors.New("request body must contain a single JSON value"),
+		}
+	}
+
+	if err := Validate(v); err != nil {
+		return &DecodeError{Status: http.StatusUnprocessableEntity, Err: err}
+	}
+
+	return nil
+}
+
+// decodeJSONError returns the DecodeError for err which was returned by
+// the JSON decoder.
+func decodeJSONError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Status: http.StatusBadRequest, Err: errors.New("request body is empty")}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Status: http.StatusBadRequest, Err: fmt.Errorf("request body is not valid JSON (%s)", err)}
+	case errors.As(err, &typeErr):
+		return &DecodeError{
+			Status: http.StatusBadRequest,
+			Err: ValidationError{{
+				Field:   typeErr.Field,
+				Rule:    "type",
+				Message: "must be of type " + typeErr.Type.String(),
+			}},
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &DecodeError{
+			Status: http.StatusBadRequest,
+			Err:    ValidationError{{Field: field, Rule: "unknown", Message: "is not a known field"}},
+		}
+	}
+
+	return &DecodeError{Status: http.StatusBadRequest, Err: err}
+}
+
+// WriteDecodeError replies to request r using err, which is usually
+// returned by DecodeJSON. Field errors are reported using the `errors`
+// member of the problem details (see Error). When err is not a
+// DecodeError, HTTP status 400 is used.
+func WriteDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadRequest
+	var de *DecodeError
+	if errors.As(err, &de) {
+		status = de.Status
+	}
+
+	var ve ValidationError
+	if errors.As(err, &ve) {
+		Error(w, r, status, "request is not valid", map[string]interface{}{"errors": ve})
+		return
+	}
+
+	Error(w, r, status, err.Error(), nil)
+}
+
+// WriteJSON encodes v as JSON and replies with it using the HTTP status
+// code. The content type is set to ContentTypeJSON.
+// When v could not be encoded, nothing is written and the error is
+// returned.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set(HeaderContentType, ContentTypeJSON)
+	w.WriteHeader(status)
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+type testSignup struct {
+	Email    string `json:"email" validate:"required,email"`
+	Name     string `json:"name" validate:"max=10"`
+	Currency string `json:"currency,omitempty" validate:"currency"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(HeaderContentType, ContentTypeJSON)
+		return req
+	}
+
+	decodeStatus := func(err error) int {
+		var de *DecodeError
+		xt.Assert(t, errors.As(err, &de), "expected DecodeError")
+		return de.Status
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		var v testSignup
+		xt.OK(t, DecodeJSON(newRequest(`{"email":"alice@example.com","name":"Alice","currency":"EUR"}`), &v))
+		xt.Eq(t, "alice@example.com", v.Email)
+		xt.Eq(t, "EUR", v.Currency)
+	})
+
+	t.Run("validation fails", func(t *testing.T) {
+		var v testSignup
+		err := DecodeJSON(newRequest(`{"name":"Alice in Wonderland","currency":"XYZ"}`), &v)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusUnprocessableEntity, decodeStatus(err))
+
+		var ve ValidationError
+		xt.Assert(t, errors.As(err, &ve))
+		xt.Eq(t, ValidationError{
+			{Field: "email", Rule: "required", Message: "is required"},
+			{Field: "name", Rule: "max", Message: "length must be at most 10"},
+			{Field: "currency", Rule: "currency", Message: "must be an ISO 4217 currency code"},
+		}, ve)
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		var v testSignup
+		err := DecodeJSON(newRequest(`{"email":"alice@example.com","admin":true}`), &v)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusBadRequest, decodeStatus(err))
+		xt.Match(t, `admin: is not a known field`, err.Error())
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		var v testSignup
+		err := DecodeJSON(newRequest(`{"email":42}`), &v)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusBadRequest, decodeStatus(err))
+		xt.Match(t, `email: must be of type string`, err.Error())
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		var v testSignup
+		err := DecodeJSON(newRequest(`{"email":`), &v)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusBadRequest, decodeStatus(err))
+
+		err = DecodeJSON(newRequest(`{} {}`), &v)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusBadRequest, decodeStatus(err))
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		var v testSignup
+		err := DecodeJSONLimit(newRequest(`{"email":"alice@example.com"}`), &v, 10)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusRequestEntityTooLarge, decodeStatus(err))
+
+		body := `{"email":"alice@example.com"}`
+		xt.OK(t, DecodeJSONLimit(newRequest(body), &v, int64(len(body))))
+
+		err = DecodeJSONLimit(newRequest(body+" "), &v, int64(len(body)))
+		xt.KO(t, err, "body of maxBytes+1 bytes must be refused")
+		xt.Eq(t, http.StatusRequestEntityTooLarge, decodeStatus(err))
+	})
+
+	t.Run("content type not JSON", func(t *testing.T) {
+		req := newRequest(`{}`)
+		req.Header.Set(HeaderContentType, ContentTypePlain)
+		var v testSignup
+		err := DecodeJSON(req, &v)
+		xt.KO(t, err)
+		xt.Eq(t, http.StatusUnsupportedMediaType, decodeStatus(err))
+	})
+}
+
+func TestWriteDecodeError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"nope"}`))
+	req.Header.Set(HeaderContentType, ContentTypeJSON)
+	req.Header.Set(HeaderAccept, "application/json")
+
+	var v testSignup
+	err := DecodeJSON(req, &v)
+	xt.KO(t, err)
+
+	rr := httptest.NewRecorder()
+	WriteDecodeError(rr, req, err)
+	xt.Eq(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var doc struct {
+		Status int          `json:"status"`
+		Errors []FieldError `json:"errors"`
+	}
+	xt.OK(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	xt.Eq(t, http.StatusUnprocessableEntity, doc.Status)
+	xt.Eq(t, []FieldError{{Field: "email", Rule: "email", Message: "must be an email address"}}, doc.Errors)
+}
+
+func TestWriteJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	xt.OK(t, WriteJSON(rr, http.StatusCreated, map[string]int{"id": 42}))
+	xt.Eq(t, http.StatusCreated, rr.Code)
+	xt.Eq(t, ContentTypeJSON, rr.Header().Get(HeaderContentType))
+	xt.Eq(t, "{\"id\":42}\n", rr.Body.String())
+
+	xt.KO(t, WriteJSON(httptest.NewRecorder(), http.StatusOK, func() {}))
+}
@@ -0,0 +1,431 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xutil"
+)
+
+// Supported JWT signing algorithms.
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
+// ErrInvalidToken is returned when a JSON Web Token could not be verified.
+// Errors returned by VerifyJWT wrap it.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ClaimsContextKey is a context key which is used to register within the
+// request the claims of the verified JSON Web Token. Its associated type
+// is Claims.
+var ClaimsContextKey = &contextKey{name: "xhttp.JWT.Claims"}
+
+// Claims holds the claims of a JSON Web Token.
+type Claims map[string]interface{}
+
+// Subject returns the `sub` claim.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Issuer returns the `iss` claim.
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the `aud` claim, which can be a string or an array
+// of strings.
+func (c Claims) Audience() []string {
+	return claimStrings(c["aud"])
+}
+
+// Scopes returns the scopes of the token, found in the `scope` claim as
+// space-separated string, or in the `scp` claim as array of strings.
+func (c Claims) Scopes() []string {
+	if s, ok := c["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	return claimStrings(c["scp"])
+}
+
+// HasScope returns whether the token has scope.
+func (c Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// time returns the numeric date of claim name. Returns false when the
+// claim is not present or not a number.
+func (c Claims) time(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var res []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// JWTKey is a key used to verify the signature of JSON Web Tokens. Key
+// is a []byte for HS256, *rsa.PublicKey for RS256, and ed25519.PublicKey
+// for EdDSA.
+type JWTKey struct {
+	// ID matches the `kid` header of tokens. Tokens with a `kid` for which
+	// no key has a matching ID are verified using the first key with their
+	// algorithm which has no ID. Tokens without `kid` are verified using
+	// the first key with their algorithm, whatever its ID.
+	ID        string
+	Algorithm string
+	Key       interface{}
+}
+
+// JWTKeySet is a set of keys used to verify JSON Web Tokens.
+type JWTKeySet []JWTKey
+
+// key returns the key for the header of a token. When kid is set, a key
+// with matching ID is preferred over keys without ID. When kid is empty,
+// the first key with the algorithm is returned.
+func (ks JWTKeySet) key(kid, alg string) (JWTKey, bool) {
+	if kid != "" {
+		for _, k := range ks {
+			if k.Algorithm == alg && k.ID == kid {
+				return k, true
+			}
+		}
+	}
+
+	for _, k := range ks {
+		if k.Algorithm == alg && (k.ID == "" || kid == "") {
+			return k, true
+		}
+	}
+	return JWTKey{}, false
+}
+
+// LoadJWKS reads the JSON Web Key Set (RFC 7517) stored in the file name.
+// See ParseJWKS.
+func LoadJWKS(name string) (JWTKeySet, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses data as JSON Web Key Set (RFC 7517). Keys of type
+// `oct`, `RSA`, and `OKP` with curve Ed25519 are supported; other keys,
+// and keys used for encryption, are ignored.
+func ParseJWKS(data []byte) (JWTKeySet, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing JWKS (%w)", err)
+	}
+
+	var ks JWTKeySet
+	for i, jwk := range doc.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+
+		key := JWTKey{ID: jwk.Kid, Algorithm: jwk.Alg}
+		var err error
+
+		switch jwk.Kty {
+		case "oct":
+			key.Key, err = base64.RawURLEncoding.DecodeString(jwk.K)
+			if key.Algorithm == "" {
+				key.Algorithm = JWTAlgHS256
+			}
+		case "RSA":
+			key.Key, err = rsaPublicKey(jwk.N, jwk.E)
+			if key.Algorithm == "" {
+				key.Algorithm = JWTAlgRS256
+			}
+		case "OKP":
+			if jwk.Crv != "Ed25519" {
+				continue
+			}
+			var x []byte
+			x, err = base64.RawURLEncoding.DecodeString(jwk.X)
+			if err == nil && len(x) != ed25519.PublicKeySize {
+				err = errors.New("invalid key size")
+			}
+			key.Key = ed25519.PublicKey(x)
+			if key.Algorithm == "" {
+				key.Algorithm = JWTAlgEdDSA
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWKS key %d (%w)", i, err)
+		}
+
+		ks = append(ks, key)
+	}
+
+	return ks, nil
+}
+
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := new(big.Int).SetBytes(eb)
+	if len(nb) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
+
+// JWTOptions configures how JSON Web Tokens are verified.
+type JWTOptions struct {
+	// Keys used to verify the signature of tokens.
+	Keys JWTKeySet
+
+	// Audience, when not empty, must be in the `aud` claim of tokens.
+	Audience string
+
+	// Issuer, when not empty, must be the `iss` claim of tokens.
+	Issuer string
+
+	// Leeway is the allowed clock skew when checking the `exp` and `nbf`
+	// claims.
+	Leeway time.Duration
+
+	// Optional lets requests without bearer token pass through without
+	// claims. Requests with an invalid token are still rejected.
+	Optional bool
+}
+
+// VerifyJWT verifies the signature and the claims of the JSON Web Token
+// token using opts. The `exp` and `nbf` claims are checked when present.
+// Returns the claims, or an error wrapping ErrInvalidToken.
+func VerifyJWT(token string, opts JWTOptions) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+
+	key, ok := opts.Keys.key(header.Kid, header.Alg)
+	if !ok {
+		return nil, fmt.Errorf("%w: no key for algorithm %q and key ID %q", ErrInvalidToken, header.Alg, header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	if !verifyJWTSignature(key, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+
+	now := time.Now()
+
+	if exp, ok := claims.time("exp"); ok && !now.Before(exp.Add(opts.Leeway)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	} else if !ok && claims["exp"] != nil {
+		return nil, fmt.Errorf("%w: invalid exp claim", ErrInvalidToken)
+	}
+
+	if nbf, ok := claims.time("nbf"); ok && now.Add(opts.Leeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	} else if !ok && claims["nbf"] != nil {
+		return nil, fmt.Errorf("%w: invalid nbf claim", ErrInvalidToken)
+	}
+
+	if opts.Audience != "" && !xutil.HasString(claims.Audience(), opts.Audience) {
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+	}
+
+	if opts.Issuer != "" && claims.Issuer() != opts.Issuer {
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func decodeJWTSegment(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func verifyJWTSignature(key JWTKey, signed, sig []byte) bool {
+	switch key.Algorithm {
+	case JWTAlgHS256:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case JWTAlgRS256:
+		pub, ok := key.Key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case JWTAlgEdDSA:
+		pub, ok := key.Key.(ed25519.PublicKey)
+		if !ok || len(pub) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(pub, signed, sig)
+	}
+	return false
+}
+
+// JWTAuth returns middleware authenticating requests using the JSON Web
+// Token found as bearer token in the HTTP Authorization header. The token
+// is verified using VerifyJWT, and its claims are stored within the
+// request using ClaimsContextKey. Requests without a valid token are
+// answered with HTTP status 401.
+//
+// For example, verifying tokens using a local JWKS file:
+//
+//     keys, err := xhttp.LoadJWKS("/etc/app/jwks.json")
+//     // handle error
+//     mux.Use(xhttp.JWTAuth(xhttp.JWTOptions{
+//         Keys:     keys,
+//         Audience: "https://api.example.com",
+//     }))
+func JWTAuth(opts JWTOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				if opts.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set(HeaderWWWAuthenticate, `Bearer`)
+				Error(w, r, http.StatusUnauthorized, "401 unauthorized", nil)
+				return
+			}
+
+			claims, err := VerifyJWT(token, opts)
+			if err != nil {
+				w.Header().Set(HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				Error(w, r, http.StatusUnauthorized, "401 unauthorized", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClaimsContextKey, claims)))
+		})
+	}
+}
+
+// RequireScopes returns middleware allowing only requests of which the
+// claims, stored by JWTAuth, have all scopes. Requests without claims are
+// answered with HTTP status 401, requests missing scopes with 403. It is
+// used to guard individual routes:
+//
+//     mux.Handle(`^/admin/`, xhttp.RequireScopes("admin")(adminHandler))
+func RequireScopes(scopes ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ClaimsContextKey).(Claims)
+			if !ok {
+				w.Header().Set(HeaderWWWAuthenticate, `Bearer`)
+				Error(w, r, http.StatusUnauthorized, "401 unauthorized", nil)
+				return
+			}
+
+			for _, s := range scopes {
+				if !claims.HasScope(s) {
+					w.Header().Set(HeaderWWWAuthenticate,
+						`Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+					Error(w, r, http.StatusForbidden, "403 forbidden", nil)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
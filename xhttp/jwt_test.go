@@ -0,0 +1,248 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+// signTestJWT returns a token with claims signed using key.
+func signTestJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, err := json.Marshal(header)
+	xt.OK(t, err)
+	c, err := json.Marshal(claims)
+	xt.OK(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		xt.OK(t, err)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	secret := []byte("s3cret-s3cret-s3cret-s3cret-s3cret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	xt.OK(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	xt.OK(t, err)
+
+	opts := JWTOptions{
+		Keys: JWTKeySet{
+			{ID: "hmac", Algorithm: JWTAlgHS256, Key: secret},
+			{ID: "rsa", Algorithm: JWTAlgRS256, Key: &rsaKey.PublicKey},
+			{ID: "ed", Algorithm: JWTAlgEdDSA, Key: edPub},
+		},
+		Audience: "api",
+		Issuer:   "https://auth.example.com",
+	}
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{
+		"sub": "alice",
+		"iss": "https://auth.example.com",
+		"aud": []string{"web", "api"},
+		"exp": now + 60,
+		"nbf": now - 60,
+	}
+
+	t.Run("algorithms", func(t *testing.T) {
+		for _, c := range []struct {
+			alg string
+			kid string
+			key interface{}
+		}{
+			{alg: JWTAlgHS256, kid: "hmac", key: secret},
+			{alg: JWTAlgRS256, kid: "rsa", key: rsaKey},
+			{alg: JWTAlgEdDSA, kid: "ed", key: edKey},
+			{alg: JWTAlgEdDSA, key: edKey},
+		} {
+			t.Run(c.alg, func(t *testing.T) {
+				claims, err := VerifyJWT(signTestJWT(t, c.alg, c.kid, c.key, valid), opts)
+				xt.OK(t, err)
+				xt.Eq(t, "alice", claims.Subject())
+			})
+		}
+	})
+
+	t.Run("key without ID", func(t *testing.T) {
+		opts := JWTOptions{Keys: JWTKeySet{{Algorithm: JWTAlgHS256, Key: secret}}}
+		for _, kid := range []string{"", "2022-05"} {
+			claims, err := VerifyJWT(signTestJWT(t, JWTAlgHS256, kid, secret, valid), opts)
+			xt.OK(t, err)
+			xt.Eq(t, "alice", claims.Subject())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		with := func(name string, v interface{}) map[string]interface{} {
+			c := map[string]interface{}{}
+			for k, v := range valid {
+				c[k] = v
+			}
+			c[name] = v
+			return c
+		}
+
+		_, wrongKey, err := ed25519.GenerateKey(rand.Reader)
+		xt.OK(t, err)
+
+		cases := map[string]string{
+			"expired":          signTestJWT(t, JWTAlgHS256, "hmac", secret, with("exp", now-1)),
+			"not valid yet":    signTestJWT(t, JWTAlgHS256, "hmac", secret, with("nbf", now+60)),
+			"audience":         signTestJWT(t, JWTAlgHS256, "hmac", secret, with("aud", "other")),
+			"issuer":           signTestJWT(t, JWTAlgHS256, "hmac", secret, with("iss", "https://evil.example.com")),
+			"invalid exp":      signTestJWT(t, JWTAlgHS256, "hmac", secret, with("exp", "tomorrow")),
+			"signature":        signTestJWT(t, JWTAlgEdDSA, "ed", wrongKey, valid),
+			"unknown kid":      signTestJWT(t, JWTAlgHS256, "nope", secret, valid),
+			"algorithm switch": signTestJWT(t, JWTAlgHS256, "rsa", secret, valid),
+			"none":             signTestJWT(t, "none", "", nil, valid),
+			"malformed":        "not.a-token",
+		}
+
+		for name, token := range cases {
+			t.Run(name, func(t *testing.T) {
+				_, err := VerifyJWT(token, opts)
+				xt.KO(t, err)
+				xt.Assert(t, errors.Is(err, ErrInvalidToken))
+			})
+		}
+	})
+
+	t.Run("leeway", func(t *testing.T) {
+		token := signTestJWT(t, JWTAlgHS256, "hmac", secret, map[string]interface{}{
+			"aud": "api", "iss": "https://auth.example.com", "exp": now - 5,
+		})
+		opts := opts
+		opts.Leeway = 30 * time.Second
+		_, err := VerifyJWT(token, opts)
+		xt.OK(t, err)
+	})
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	xt.OK(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	xt.OK(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "k1", "k": b64([]byte("secret"))},
+			{"kty": "RSA", "kid": "k2", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "OKP", "kid": "k3", "crv": "Ed25519", "x": b64(edPub)},
+			{"kty": "RSA", "kid": "k4", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+			{"kty": "EC", "kid": "k5", "crv": "P-256"},
+		},
+	})
+	xt.OK(t, err)
+
+	name := filepath.Join(t.TempDir(), "jwks.json")
+	xt.OK(t, os.WriteFile(name, jwks, 0o600))
+
+	ks, err := LoadJWKS(name)
+	xt.OK(t, err)
+	xt.Eq(t, 3, len(ks))
+
+	xt.Eq(t, JWTAlgHS256, ks[0].Algorithm)
+	xt.Eq(t, []byte("secret"), ks[0].Key)
+	xt.Eq(t, JWTAlgRS256, ks[1].Algorithm)
+	xt.Eq(t, rsaKey.PublicKey.E, ks[1].Key.(*rsa.PublicKey).E)
+	xt.Eq(t, JWTAlgEdDSA, ks[2].Algorithm)
+	xt.Eq(t, edPub, ks[2].Key)
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := ParseJWKS([]byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AAAA"}]}`))
+		xt.KO(t, err)
+	})
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("s3cret-s3cret-s3cret-s3cret-s3cret")
+	exp := time.Now().Add(time.Minute).Unix()
+
+	mux := NewServeReMux()
+	mux.Use(JWTAuth(JWTOptions{Keys: JWTKeySet{{Algorithm: JWTAlgHS256, Key: secret}}}))
+	mux.Handle(`^/me$`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(ClaimsContextKey).(Claims)
+		_, _ = w.Write([]byte(claims.Subject()))
+	}))
+	mux.Handle(`^/admin$`, RequireScopes("admin")(pathEchoHandler{}))
+
+	serve := func(p, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		if token != "" {
+			req.Header.Set(HeaderAuthorization, "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	user := signTestJWT(t, JWTAlgHS256, "", secret, map[string]interface{}{
+		"sub": "alice", "exp": exp, "scope": "read write",
+	})
+	admin := signTestJWT(t, JWTAlgHS256, "", secret, map[string]interface{}{
+		"sub": "bob", "exp": exp, "scp": []string{"read", "admin"},
+	})
+
+	t.Run("claims in context", func(t *testing.T) {
+		rr := serve("/me", user)
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "alice", rr.Body.String())
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		rr := serve("/me", "")
+		xt.Eq(t, http.StatusUnauthorized, rr.Code)
+		xt.Eq(t, "Bearer", rr.Header().Get(HeaderWWWAuthenticate))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		rr := serve("/me", user+"x")
+		xt.Eq(t, http.StatusUnauthorized, rr.Code)
+		xt.Eq(t, `Bearer error="invalid_token"`, rr.Header().Get(HeaderWWWAuthenticate))
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		rr := serve("/admin", user)
+		xt.Eq(t, http.StatusForbidden, rr.Code)
+		xt.Eq(t, `Bearer error="insufficient_scope", scope="admin"`, rr.Header().Get(HeaderWWWAuthenticate))
+
+		xt.Eq(t, http.StatusOK, serve("/admin", admin).Code)
+	})
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import "net/http"
+
+// Middleware wraps a http.Handler returning a new http.Handler. It is used
+// to add functionality, like authentication or logging, to handlers
+// registered with ServeReMux.
+type Middleware func(http.Handler) http.Handler
+
+// chainMiddleware wraps h with each middleware in mw. The first middleware
+// is the outermost, meaning it handles the request first.
+func chainMiddleware(h http.Handler, mw []Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
@@ -21,8 +21,13 @@ type Method string
 // HTTP method constants which are exactly the same as Go's http.Method*
 // but typed with our own.
 const (
-	MethodGet  Method = "GET"
-	MethodPost Method = "POST"
+	MethodGet     Method = "GET"
+	MethodHead    Method = "HEAD"
+	MethodPost    Method = "POST"
+	MethodPut     Method = "PUT"
+	MethodPatch   Method = "PATCH"
+	MethodDelete  Method = "DELETE"
+	MethodOptions Method = "OPTIONS"
 )
 
 const defaultCaptureConverter = "str"
@@ -67,6 +72,15 @@ func (c Capture) AsInt() (int, error) {
 
 type Captures map[string]Capture
 
+// captureRegs maps the capture converters to the regular expression
+// replacing the capture within the pattern.
+var captureRegs = map[string]string{
+	"int": `(?P<%s>\d{1,19})`, // digits of 2^64-1
+	"str": `(?P<%s>[\w-_]+)`,
+}
+
+var reCaptures = regexp.MustCompile(`<((?:(int|str):)?([0-9A-Za-z_]+))>`)
+
 type reHandler struct {
 	pattern  string
 	regex    string
@@ -74,6 +88,8 @@ type reHandler struct {
 	handler  http.Handler
 	methods  []Method
 	captures Captures
+	mounted  *ServeReMux
+	name     string
 }
 
 // setPattern will store pattern into r after validating it and setting up
@@ -82,13 +98,6 @@ type reHandler struct {
 // unsupported converted type is used for capturing values, and when anything
 // is wrong when parsing captures.
 func (r *reHandler) setPattern(pattern string) {
-	captureRegs := map[string]string{
-		"int": `(?P<%s>\d{1,19})`, // digits of 2^64-1
-		"str": `(?P<%s>[\w-_]+)`,
-	}
-
-	reCaptures := regexp.MustCompile(`<((?:(int|str):)?([0-9A-Za-z_]+))>`)
-
 	matches := reCaptures.FindAllStringSubmatch(pattern, -1)
 	newPattern := pattern
 	pos := 0
@@ -102,7 +111,6 @@ func (r *reHandler) setPattern(pattern string) {
 				panic("xhttp: pattern capture value `" + name + "` specified twice")
 			}
 
-			_ = captureRegs
 			capConverter := m[2]
 			if capConverter == "" {
 				capConverter = defaultCaptureConverter
@@ -157,7 +165,8 @@ func (r *reHandler) setPattern(pattern string) {
 }
 
 func (r reHandler) allowedMethod(method Method) bool {
-	if len(r.methods) == 0 && method == MethodGet {
+	if len(r.methods) == 0 && (method == MethodGet || r.mounted != nil) {
+		// mounted ServeReMux without methods leaves it to its own routes
 		return true
 	}
 
@@ -170,6 +179,46 @@ func (r reHandler) allowedMethod(method Method) bool {
 	return false
 }
 
+// mountedPath returns the part of p following the prefix of the mounted
+// ServeReMux r, and whether p matches the prefix. The prefix must end at a
+// path segment boundary: `^/api/v1` matches `/api/v1/persons`, but not
+// `/api/v1persons`.
+func (r reHandler) mountedPath(p string) (string, bool) {
+	loc := r.compiled.FindStringIndex(p)
+	if loc == nil {
+		return "", false
+	}
+
+	rest := p[loc[1]:]
+	if rest != "" && rest[0] != '/' && (loc[1] == 0 || p[loc[1]-1] != '/') {
+		return "", false
+	}
+
+	return requestPathCleanUp(rest), true
+}
+
+// capturesFrom returns the captured values found in p. When r has no
+// captures, nil is returned.
+func (r reHandler) capturesFrom(p string) Captures {
+	if r.captures == nil {
+		return nil
+	}
+
+	caps := Captures{}
+	matches := r.compiled.FindStringSubmatch(p)
+	for i, name := range r.compiled.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		caps[name] = Capture{
+			Name:      name,
+			Value:     matches[i],
+			Converter: r.captures[name].Converter,
+		}
+	}
+	return caps
+}
+
 // ServeReMux is an HTTP request multiplexer which matches the path
 // of the URL of each incoming request against a list of
 // registered patterns provide as regular expressions.
@@ -200,8 +249,31 @@ func (r reHandler) allowedMethod(method Method) bool {
 // When no regular expression matched, 404 is returned. If a pattern
 // matches, but it turns out the method was not allowed, the HTTP status
 // 405 (method not allowed) is returned.
+//
+// Another ServeReMux can be mounted using a prefix, which is stripped from
+// the path before the routes of the mounted ServeReMux are matched. Values
+// captured by the prefix are merged with those of the mounted routes:
+//
+//     api := xhttp.NewServeReMux()
+//     api.Use(Authenticate)
+//     api.Handle("^/person/<int:id>$", PersonHandler(), xhttp.MethodGet)
+//     mux.Mount("^/org/<orgUID>/api/v1", api)
 type ServeReMux struct {
-	handlers xutil.OrderedMap
+	handlers         xutil.OrderedMap
+	middleware       []Middleware
+	names            map[string]string // route name mapped to its pattern
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+// routeMatch holds the result of matching a request path against the
+// registered patterns.
+type routeMatch struct {
+	handler  http.Handler
+	pattern  string
+	captures Captures
+	path     string   // path with prefixes of mounted ServeReMux stripped
+	allowed  []Method // allowed methods when method was not allowed
 }
 
 // NewServeReMux allocates and returns a new ServeReMux.
@@ -235,6 +307,105 @@ func (s *ServeReMux) HandleFunc(pattern string, handler func(http.ResponseWriter
 	s.Handle(pattern, http.HandlerFunc(handler), method...)
 }
 
+// HandleNamed registers the handler for the given pattern like Handle, but
+// also names the route so that its URL can be built using ServeReMux.URL.
+// Panics when name is empty or already used, or for the same reasons as
+// Handle.
+func (s *ServeReMux) HandleNamed(name, pattern string, handler http.Handler, methods ...Method) {
+	if name == "" {
+		panic("xhttp: route name must not be empty")
+	}
+	if _, have := s.names[name]; have {
+		panic("xhttp: route name `" + name + "` already registered")
+	}
+
+	s.Handle(pattern, handler, methods...)
+
+	v, _ := s.handlers.Value(pattern)
+	v.(*reHandler).name = name
+	if s.names == nil {
+		s.names = map[string]string{}
+	}
+	s.names[name] = pattern
+}
+
+// HandleFuncNamed registers the handler function for the given pattern like
+// HandleFunc, naming the route. See HandleNamed.
+func (s *ServeReMux) HandleFuncNamed(name, pattern string, handler func(http.ResponseWriter, *http.Request), method ...Method) {
+	if handler == nil {
+		panic("xhttp: nil handler")
+	}
+	s.HandleNamed(name, pattern, http.HandlerFunc(handler), method...)
+}
+
+// SetNotFoundHandler sets the handler used by s when no route matched
+// the request. When h is nil, NotFoundHandler is used.
+// The handler of a mounted ServeReMux is not used; requests not matching
+// any of its routes are handled by the ServeReMux it is mounted on.
+func (s *ServeReMux) SetNotFoundHandler(h http.Handler) {
+	s.notFound = h
+}
+
+// SetMethodNotAllowedHandler sets the handler used by s when a route
+// matched the request, but the method was not allowed. When h is nil,
+// MethodNotAllowedHandler is used.
+// The HTTP Allow header is set before h is called.
+func (s *ServeReMux) SetMethodNotAllowedHandler(h http.Handler) {
+	s.methodNotAllowed = h
+}
+
+// Use appends middleware to s. The middleware wraps every request
+// handled by s, including those for which no route was found. When s is
+// mounted, the middleware is only used for requests routed to s.
+func (s *ServeReMux) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// Mount registers sub to handle requests of which the path matches prefix.
+// The prefix is a regular expression which must start with `^`, and can
+// have captures like any other pattern. The part of the path matching
+// prefix is stripped before the routes of sub are matched. Captured values
+// of the prefix are merged with those of sub; values captured by sub take
+// precedence.
+//
+// When methods are provided, the routes of sub are only allowed using
+// these methods, and 405 is returned otherwise. When no methods are
+// provided, it is up to the routes registered with sub.
+//
+// Panics when prefix is already registered, is not anchored, or could not
+// be compiled.
+func (s *ServeReMux) Mount(prefix string, sub *ServeReMux, methods ...Method) {
+	if sub == nil {
+		panic("xhttp: nil ServeReMux")
+	}
+	if !strings.HasPrefix(prefix, "^") {
+		panic("xhttp: mount prefix must start with `^`; was " + prefix)
+	}
+	if s.handlers.Has(prefix) {
+		panic("xhttp: pattern `" + prefix + "` already registered")
+	}
+
+	h := &reHandler{}
+	h.setPattern(prefix)
+	h.methods = methods
+	h.handler = sub
+	h.mounted = sub
+
+	s.handlers.Set(prefix, h)
+}
+
+// Group creates a new ServeReMux, mounts it using prefix (see Mount), and
+// calls fn so that routes and middleware can be registered with it.
+// The group is returned.
+func (s *ServeReMux) Group(prefix string, fn func(g *ServeReMux), methods ...Method) *ServeReMux {
+	g := NewServeReMux()
+	if fn != nil {
+		fn(g)
+	}
+	s.Mount(prefix, g, methods...)
+	return g
+}
+
 // ServeHTTP dispatches the request to the handler whose
 // regular expression matches the path of the request URL.
 func (s *ServeReMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -246,15 +417,27 @@ func (s *ServeReMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	h, pattern, captures := s.Handler(r)
-	ctx := context.WithValue(r.Context(), CapturesContextKey, captures)
-	ctx = context.WithValue(ctx, RegexpMatchContextKey, pattern)
+
+	m := s.route(r)
+	captures := m.captures
+	if captures == nil {
+		captures = Captures{}
+	}
+	ctx := context.WithValue(r.Context(), CapturesContextKey, &captures)
+	ctx = context.WithValue(ctx, RegexpMatchContextKey, m.pattern)
+	if len(m.allowed) > 0 {
+		ctx = context.WithValue(ctx, AllowedMethodsContextKey, m.allowed)
+		w.Header().Set(HeaderAllow, joinMethods(m.allowed))
+	}
 	r = r.Clone(ctx)
-	h.ServeHTTP(w, r)
+	if m.path != "" && m.path != r.URL.Path {
+		r.URL.Path = m.path
+		r.URL.RawPath = ""
+	}
+	chainMiddleware(m.handler, s.middleware).ServeHTTP(w, r)
 }
 
-func (s *ServeReMux) findMatch(r *http.Request) (http.Handler, string, Captures, bool) {
-	p := requestPathCleanUp(r.URL.Path)
+func (s *ServeReMux) findMatch(p string, method Method) (*routeMatch, bool) {
 	var foundMatchButNotAllowed bool
 
 	for _, v := range s.handlers.Values() {
@@ -263,53 +446,173 @@ func (s *ServeReMux) findMatch(r *http.Request) (http.Handler, string, Captures,
 			panic(fmt.Sprintf("xhttp: ServeReMux has unsupported handler registered; was %v", p))
 		}
 
+		if h.mounted != nil {
+			subPath, ok := h.mountedPath(p)
+			if !ok {
+				continue
+			}
+
+			m, notAllowed := h.mounted.findMatch(subPath, method)
+			switch {
+			case m != nil && h.allowedMethod(method):
+				if m.path == "" {
+					m.path = subPath
+				}
+				m.handler = chainMiddleware(m.handler, h.mounted.middleware)
+				m.pattern = joinPatterns(h.pattern, m.pattern)
+				m.captures = mergeCaptures(h.capturesFrom(p), m.captures)
+				return m, false
+			case m != nil || notAllowed:
+				foundMatchButNotAllowed = true
+			}
+			continue
+		}
+
 		subMux, ok := h.handler.(*ServeReMux)
 		if ok {
-			h, p, c, f := subMux.findMatch(r)
-			if h != nil {
-				return h, p, c, f
+			if m, _ := subMux.findMatch(p, method); m != nil {
+				m.handler = chainMiddleware(m.handler, subMux.middleware)
+				return m, false
 			}
 		}
 
 		if h.compiled.MatchString(p) {
-			if h.allowedMethod(Method(r.Method)) {
-				var captures Captures
-				if h.captures != nil {
-					caps := Captures{}
-					matches := h.compiled.FindStringSubmatch(p)
-					for i, name := range h.compiled.SubexpNames() {
-						if i != 0 {
-							caps[name] = Capture{
-								Name:      name,
-								Value:     matches[i],
-								Converter: h.captures[name].Converter,
-							}
-						}
-					}
-					captures = caps
-				}
-				return h.handler, h.pattern, captures, false
+			if h.allowedMethod(method) {
+				return &routeMatch{
+					handler:  h.handler,
+					pattern:  h.pattern,
+					captures: h.capturesFrom(p),
+				}, false
 			}
 			foundMatchButNotAllowed = true
 		}
 	}
 
-	return nil, "", nil, foundMatchButNotAllowed
+	return nil, foundMatchButNotAllowed
+}
+
+// route returns the match for r. When no match was found, the returned
+// match uses either the not found or the method not allowed handler.
+func (s *ServeReMux) route(r *http.Request) *routeMatch {
+	p := requestPathCleanUp(r.URL.Path)
+	m, foundMatchButNotAllowed := s.findMatch(p, Method(r.Method))
+	if m == nil {
+		if foundMatchButNotAllowed {
+			h := s.methodNotAllowed
+			if h == nil {
+				h = MethodNotAllowedHandler()
+			}
+			return &routeMatch{handler: h, allowed: s.allowedMethods(p)}
+		}
+
+		h := s.notFound
+		if h == nil {
+			h = NotFoundHandler()
+		}
+		return &routeMatch{handler: h}
+	}
+
+	return m
+}
+
+// allowedMethods returns the methods allowed by the routes matching p.
+func (s *ServeReMux) allowedMethods(p string) []Method {
+	var allowed []Method
+	add := func(methods ...Method) {
+		for _, m := range methods {
+			if !hasMethod(allowed, m) {
+				allowed = append(allowed, m)
+			}
+		}
+	}
+
+	for _, v := range s.handlers.Values() {
+		h, ok := v.(*reHandler)
+		if !ok {
+			continue
+		}
+
+		if h.mounted != nil {
+			subPath, ok := h.mountedPath(p)
+			if !ok {
+				continue
+			}
+			for _, m := range h.mounted.allowedMethods(subPath) {
+				if h.allowedMethod(m) {
+					add(m)
+				}
+			}
+			continue
+		}
+
+		if subMux, ok := h.handler.(*ServeReMux); ok {
+			add(subMux.allowedMethods(p)...)
+		}
+
+		if h.compiled.MatchString(p) {
+			if len(h.methods) == 0 {
+				add(MethodGet)
+			}
+			add(h.methods...)
+		}
+	}
+
+	return allowed
+}
+
+func hasMethod(methods []Method, method Method) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func joinMethods(methods []Method) string {
+	s := make([]string, len(methods))
+	for i, m := range methods {
+		s[i] = string(m)
+	}
+	return strings.Join(s, ", ")
 }
 
 // Handler returns the handler to use for the given request.
 // Panics when registered handler is not supported.
 func (s *ServeReMux) Handler(r *http.Request) (http.Handler, string, Captures) {
-	handler, pattern, captures, foundMatchButNotAllowed := s.findMatch(r)
-	if handler == nil {
-		if foundMatchButNotAllowed {
-			return MethodNotAllowedHandler(), "", nil
+	m := s.route(r)
+	return m.handler, m.pattern, m.captures
+}
+
+// joinPatterns returns the pattern of a route registered with a mounted
+// ServeReMux as if it was registered using the prefix.
+func joinPatterns(prefix, pattern string) string {
+	if strings.HasPrefix(pattern, "^") {
+		pattern = pattern[1:]
+		if strings.HasPrefix(pattern, "/") {
+			// prefix `^/api/` with `^/persons` is `^/api/persons`
+			prefix = strings.TrimSuffix(prefix, "/")
 		}
+		return prefix + pattern
+	}
+	return prefix + ".*" + pattern
+}
 
-		return NotFoundHandler(), "", nil
+// mergeCaptures returns a new Captures containing the values of both
+// parent and child. Values of child take precedence.
+func mergeCaptures(parent, child Captures) Captures {
+	if parent == nil {
+		return child
 	}
 
-	return handler, pattern, captures
+	res := Captures{}
+	for k, v := range parent {
+		res[k] = v
+	}
+	for k, v := range child {
+		res[k] = v
+	}
+	return res
 }
 
 // requestPathCleanUp uses Go's path.Clean to clean up p.
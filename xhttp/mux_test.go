@@ -298,3 +298,125 @@ func TestServeReMux_Handle(t *testing.T) {
 		})
 	})
 }
+
+func TestServeReMux_Mount(t *testing.T) {
+	serve := func(mux *ServeReMux, method, p string) (*httptest.ResponseRecorder, responseData) {
+		req, err := http.NewRequest(method, p, nil)
+		xt.OK(t, err)
+		req.Header.Set("Content-Type", ContentTypeJSON)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		var data responseData
+		xt.OK(t, json.Unmarshal(rr.Body.Bytes(), &data))
+		return rr, data
+	}
+
+	t.Run("prefix is stripped", func(t *testing.T) {
+		api := NewServeReMux()
+		api.Handle(`^/persons$`, pathEchoHandler{})
+
+		mux := NewServeReMux()
+		mux.Mount(`^/api/v1`, api)
+
+		rr, data := serve(mux, http.MethodGet, "/api/v1/persons")
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "/persons", data.Path)
+		xt.Eq(t, "^/api/v1/persons$", data.Pattern)
+
+		rr, _ = serve(mux, http.MethodGet, "/persons")
+		xt.Eq(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("prefix ends at path segment", func(t *testing.T) {
+		api := NewServeReMux()
+		api.Handle(`^/persons$`, pathEchoHandler{}, MethodGet)
+
+		mux := NewServeReMux()
+		mux.Mount(`^/api/v1`, api)
+		mux.Mount(`^/api/v2/`, api)
+
+		rr, _ := serve(mux, http.MethodGet, "/api/v1persons")
+		xt.Eq(t, http.StatusNotFound, rr.Code)
+
+		rr, _ = serve(mux, http.MethodPost, "/api/v1persons")
+		xt.Eq(t, http.StatusNotFound, rr.Code)
+
+		rr, data := serve(mux, http.MethodGet, "/api/v2/persons")
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "/persons", data.Path)
+	})
+
+	t.Run("captures of parent and child are merged", func(t *testing.T) {
+		api := NewServeReMux()
+		api.Handle(`^/person/<int:id>$`, captureHandler{})
+
+		mux := NewServeReMux()
+		mux.Mount(`^/org/<orgUID>`, api)
+
+		rr, data := serve(mux, http.MethodGet, "/org/Y4sSn8f/person/42")
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, &Captures{
+			"orgUID": Capture{Name: "orgUID", Value: "Y4sSn8f", Converter: "str"},
+			"id":     Capture{Name: "id", Value: "42", Converter: "int"},
+		}, data.Captures)
+	})
+
+	t.Run("group shares middleware and methods", func(t *testing.T) {
+		var used int
+		mux := NewServeReMux()
+		mux.Group(`^/admin`, func(g *ServeReMux) {
+			g.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					used++
+					next.ServeHTTP(w, r)
+				})
+			})
+			g.Handle(`^/users$`, pathEchoHandler{}, MethodGet, MethodPost)
+		}, MethodGet)
+		mux.Handle(`^/users$`, pathEchoHandler{})
+
+		rr, _ := serve(mux, http.MethodGet, "/admin/users")
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, 1, used)
+
+		rr, _ = serve(mux, http.MethodPost, "/admin/users")
+		xt.Eq(t, http.StatusMethodNotAllowed, rr.Code)
+		xt.Eq(t, 1, used)
+
+		rr, _ = serve(mux, http.MethodGet, "/users")
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, 1, used)
+	})
+
+	t.Run("prefix must be anchored", func(t *testing.T) {
+		xt.Panics(t, func() {
+			NewServeReMux().Mount(`/api`, NewServeReMux())
+		})
+	})
+}
+
+func TestServeReMux_SetNotFoundHandler(t *testing.T) {
+	mux := NewServeReMux()
+	mux.Handle(`^/postonly$`, pathEchoHandler{}, MethodPost, MethodPut)
+	mux.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	mux.SetMethodNotAllowedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+
+	t.Run("not found", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/nope", nil))
+		xt.Eq(t, http.StatusTeapot, rr.Code)
+	})
+
+	t.Run("method not allowed sets Allow header", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/postonly", nil))
+		xt.Eq(t, http.StatusConflict, rr.Code)
+		xt.Eq(t, "POST, PUT", rr.Header().Get(HeaderAllow))
+	})
+}
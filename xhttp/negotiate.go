@@ -0,0 +1,125 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a media range found in the HTTP Accept header.
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// specificity returns how specific the media range a is. A range with
+// wildcards is less specific.
+func (a acceptRange) specificity() int {
+	switch {
+	case a.typ == "*":
+		return 0
+	case a.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// matches returns whether a matches the media type typ/subtype.
+func (a acceptRange) matches(typ, subtype string) bool {
+	return (a.typ == "*" || a.typ == typ) && (a.subtype == "*" || a.subtype == subtype)
+}
+
+// parseAccept parses the value of the HTTP Accept header and returns the
+// media ranges sorted by specificity, most specific first. Invalid media
+// ranges are ignored.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		fields := strings.SplitN(mediaType, "/", 2)
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			continue
+		}
+
+		ar := acceptRange{typ: fields[0], subtype: fields[1], q: 1}
+		if q, have := params["q"]; have {
+			if ar.q, err = strconv.ParseFloat(q, 64); err != nil || ar.q < 0 || ar.q > 1 {
+				continue
+			}
+		}
+
+		ranges = append(ranges, ar)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+
+	return ranges
+}
+
+// NegotiateContentType returns the best content type of offers for the
+// request r using its HTTP Accept header, which can contain quality
+// values (q). When no Accept header is available, or none of the offers
+// are acceptable, defaultOffer is returned. Offers refused by the client
+// using q=0 are never returned, except as defaultOffer. When using an
+// empty defaultOffer, the caller should reply with HTTP status 406 Not
+// Acceptable when the result is empty.
+//
+// Offers are content types like ContentTypeJSON; parameters like the
+// charset are ignored when matching. When offers are equally acceptable,
+// the one which comes first is returned.
+func NegotiateContentType(r *http.Request, offers []string, defaultOffer string) string {
+	header := r.Header.Get(HeaderAccept)
+	if header == "" {
+		return defaultOffer
+	}
+
+	ranges := parseAccept(header)
+	bestOffer := defaultOffer
+	bestQ := 0.0
+	bestSpecificity := -1
+
+	for _, offer := range offers {
+		mediaType, _, err := mime.ParseMediaType(offer)
+		if err != nil {
+			continue
+		}
+		fields := strings.SplitN(mediaType, "/", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// the most specific matching range determines the quality; offers
+		// refused using q=0 are never chosen
+		for _, ar := range ranges {
+			if !ar.matches(fields[0], fields[1]) {
+				continue
+			}
+
+			if ar.q > 0 && (ar.q > bestQ || (ar.q == bestQ && ar.specificity() > bestSpecificity)) {
+				bestOffer = offer
+				bestQ = ar.q
+				bestSpecificity = ar.specificity()
+			}
+			break
+		}
+	}
+
+	return bestOffer
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{ContentTypePlain, ContentTypeHTML, ContentTypeJSON}
+
+	cases := map[string]struct {
+		accept string
+		exp    string
+	}{
+		"no accept header":           {accept: "", exp: ContentTypeBinary},
+		"exact match":                {accept: "application/json", exp: ContentTypeJSON},
+		"wildcard uses first offer":  {accept: "*/*", exp: ContentTypePlain},
+		"specific before wildcard":   {accept: "*/*, text/html", exp: ContentTypeHTML},
+		"highest quality":            {accept: "text/html;q=0.5, application/json;q=0.9", exp: ContentTypeJSON},
+		"subtype wildcard":           {accept: "image/png, text/*;q=0.3", exp: ContentTypePlain},
+		"quality zero excludes":      {accept: "text/plain;q=0, */*", exp: ContentTypeHTML},
+		"refused offer":              {accept: "application/json;q=0", exp: ContentTypeBinary},
+		"refused by wildcard":        {accept: "*/*;q=0", exp: ContentTypeBinary},
+		"nothing acceptable":         {accept: "image/png", exp: ContentTypeBinary},
+		"invalid ranges are ignored": {accept: "foo, application/json;q=abc, text/html", exp: ContentTypeHTML},
+		"browser":                    {accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", exp: ContentTypeHTML},
+	}
+
+	for name, cs := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			xt.OK(t, err)
+			if cs.accept != "" {
+				req.Header.Set(HeaderAccept, cs.accept)
+			}
+			xt.Eq(t, cs.exp, NegotiateContentType(req, offers, ContentTypeBinary))
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import "strings"
+
+const openAPIVersion = "3.0.3"
+
+// OpenAPIDocument is a skeleton OpenAPI 3 document describing the paths
+// served by ServeReMux. It is meant to be encoded as JSON.
+type OpenAPIDocument struct {
+	OpenAPI string                     `json:"openapi"`
+	Info    OpenAPIInfo                `json:"info"`
+	Paths   map[string]OpenAPIPathItem `json:"paths"`
+}
+
+// OpenAPIInfo holds the metadata of the API.
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIPathItem maps the lower-case HTTP methods to the operation of a path.
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation describes an API operation on a path.
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter describes a parameter of an operation.
+type OpenAPIParameter struct {
+	Name     string        `json:"name"`
+	In       string        `json:"in"`
+	Required bool          `json:"required"`
+	Schema   OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema describes the data type of a parameter.
+type OpenAPISchema struct {
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"`
+}
+
+// OpenAPIResponse describes a response of an operation.
+type OpenAPIResponse struct {
+	Description string `json:"description"`
+}
+
+// openAPISchemas maps capture converters to their OpenAPI schema.
+var openAPISchemas = map[string]OpenAPISchema{
+	"int": {Type: "integer", Format: "int64"},
+	"str": {Type: "string"},
+}
+
+// NewOpenAPIDocument returns a skeleton OpenAPI 3 document using the
+// title and version of the API, and describing the paths of routes, which
+// is usually the result of ServeReMux.Routes.
+// Captures are added as required path parameters typed using their
+// converter. The name of the route is used as operation ID, suffixed
+// with the method when the route allows more than one method.
+//
+// Routes of which the pattern contains regular expression syntax other
+// than captures cannot be expressed as path, and are skipped. When more
+// routes result in the same path and method, the first one is used, as
+// ServeReMux would do.
+func NewOpenAPIDocument(title, version string, routes []Route) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   title,
+			Version: version,
+		},
+		Paths: map[string]OpenAPIPathItem{},
+	}
+
+	for _, r := range routes {
+		p, err := buildPath(r.Pattern, func(name, _ string) (string, error) {
+			return "{" + name + "}", nil
+		})
+		if err != nil {
+			continue
+		}
+
+		var params []OpenAPIParameter
+		seen := map[string]bool{}
+		for _, c := range r.Captures {
+			if seen[c.Name] {
+				continue
+			}
+			seen[c.Name] = true
+			params = append(params, OpenAPIParameter{
+				Name:     c.Name,
+				In:       "path",
+				Required: true,
+				Schema:   openAPISchemas[c.Converter],
+			})
+		}
+
+		item, have := doc.Paths[p]
+		if !have {
+			item = OpenAPIPathItem{}
+			doc.Paths[p] = item
+		}
+
+		for _, m := range r.Methods {
+			method := strings.ToLower(string(m))
+			if _, have := item[method]; have {
+				continue
+			}
+
+			opID := r.Name
+			if opID != "" && len(r.Methods) > 1 {
+				opID += "_" + method
+			}
+
+			item[method] = &OpenAPIOperation{
+				OperationID: opID,
+				Parameters:  params,
+				Responses: map[string]OpenAPIResponse{
+					"default": {Description: "default response"},
+				},
+			}
+		}
+	}
+
+	return doc
+}
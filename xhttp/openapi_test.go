@@ -0,0 +1,44 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestNewOpenAPIDocument(t *testing.T) {
+	mux := NewServeReMux()
+	mux.HandleNamed("person", `^/person/<int:id>$`, pathEchoHandler{}, MethodGet, MethodPost)
+	mux.HandleNamed("blog", `^/blog/<blogUID>$`, pathEchoHandler{})
+	mux.Handle(`^/fo(o|bar)$`, pathEchoHandler{})
+
+	doc := NewOpenAPIDocument("Test API", "1.0", mux.Routes())
+	xt.Eq(t, "3.0.3", doc.OpenAPI)
+	xt.Eq(t, 2, len(doc.Paths))
+
+	t.Run("captures are typed path parameters", func(t *testing.T) {
+		op := doc.Paths["/person/{id}"]["get"]
+		xt.Assert(t, op != nil)
+		xt.Eq(t, "person_get", op.OperationID)
+		xt.Eq(t, []OpenAPIParameter{
+			{Name: "id", In: "path", Required: true, Schema: OpenAPISchema{Type: "integer", Format: "int64"}},
+		}, op.Parameters)
+		xt.Assert(t, doc.Paths["/person/{id}"]["post"] != nil)
+
+		op = doc.Paths["/blog/{blogUID}"]["get"]
+		xt.Eq(t, "blog", op.OperationID)
+		xt.Eq(t, "string", op.Parameters[0].Schema.Type)
+	})
+
+	t.Run("encode as JSON", func(t *testing.T) {
+		data, err := json.Marshal(doc)
+		xt.OK(t, err)
+
+		var m map[string]interface{}
+		xt.OK(t, json.Unmarshal(data, &m))
+		xt.Eq(t, "Test API", m["info"].(map[string]interface{})["title"])
+	})
+}
@@ -2,7 +2,17 @@
 
 package xhttp
 
-import "time"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xlog"
+)
 
 // ClientOption is the functional option type used with
 // xhttp.Client.
@@ -13,6 +23,20 @@ type clientOptions struct {
 	TLSInsecureSkipVerify bool
 	Timeout               time.Duration
 	ContentType           string
+	Retry                 *RetryPolicy
+	Authenticator         Authenticator
+	TLSRootCAs            *x509.CertPool
+	TLSCertificates       []tls.Certificate
+	TLSMinVersion         uint16
+	TLSServerName         string
+	Logger                *xlog.Logger
+	Tracer                ClientTracer
+	RoundTripper          http.RoundTripper
+	CircuitBreaker        *circuitBreaker
+
+	// err is set when an option failed; it is returned when making
+	// requests.
+	err error
 }
 
 func (co clientOptions) getContentType() string {
@@ -25,6 +49,17 @@ func newClientOptions() *clientOptions {
 		TLSInsecureSkipVerify: false,
 		Timeout:               0,
 		ContentType:           defaultContentType,
+		TLSMinVersion:         tls.VersionTLS12,
+	}
+}
+
+func (co clientOptions) tlsConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: co.TLSInsecureSkipVerify,
+		RootCAs:            co.TLSRootCAs,
+		Certificates:       co.TLSCertificates,
+		MinVersion:         co.TLSMinVersion,
+		ServerName:         co.TLSServerName,
 	}
 }
 
@@ -55,3 +90,110 @@ func WithContentType(c string) ClientOption {
 		options.ContentType = c
 	}
 }
+
+// WithRetry is a functional option for xhttp.NewClient retrying failed
+// requests according to policy. Requests fail when the connection fails,
+// or when the server replies with one of the HTTP status codes of the
+// policy. Only requests using idempotent methods, or having the
+// Idempotency-Key header, are retried unless the policy allows otherwise.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return func(options *clientOptions) {
+		p := policy.withDefaults()
+		options.Retry = &p
+	}
+}
+
+// WithAuthenticator is a functional option for xhttp.NewClient adding
+// credentials to each request using a. For example, to use the OAuth 2.0
+// client credentials grant:
+//
+//     c := xhttp.NewClient(uri, xhttp.WithAuthenticator(&xhttp.OAuth2ClientCredentials{
+//         TokenURL:     "https://auth.example.com/token",
+//         ClientID:     "my-service",
+//         ClientSecret: secret,
+//     }))
+func WithAuthenticator(a Authenticator) ClientOption {
+	return func(options *clientOptions) {
+		options.Authenticator = a
+	}
+}
+
+// WithTLSRootCAPEM is a functional option for xhttp.NewClient adding the
+// PEM encoded certificates to the root certificate authorities used to
+// verify servers. When used, the system certificate pool is not used.
+// When no certificates could be parsed, requests return an error.
+func WithTLSRootCAPEM(pem []byte) ClientOption {
+	return func(options *clientOptions) {
+		if options.TLSRootCAs == nil {
+			options.TLSRootCAs = x509.NewCertPool()
+		}
+		if !options.TLSRootCAs.AppendCertsFromPEM(pem) {
+			options.err = errors.New("xhttp: no certificates found in root CA PEM")
+		}
+	}
+}
+
+// WithTLSRootCAFile is a functional option for xhttp.NewClient adding the
+// PEM encoded certificates stored in the file name to the root certificate
+// authorities used to verify servers. See WithTLSRootCAPEM.
+func WithTLSRootCAFile(name string) ClientOption {
+	return func(options *clientOptions) {
+		pem, err := os.ReadFile(name)
+		if err != nil {
+			options.err = fmt.Errorf("xhttp: reading root CA file (%w)", err)
+			return
+		}
+		WithTLSRootCAPEM(pem)(options)
+	}
+}
+
+// WithTLSClientCertificate is a functional option for xhttp.NewClient
+// adding a certificate which is presented to servers requiring client
+// authentication (mutual TLS).
+func WithTLSClientCertificate(cert tls.Certificate) ClientOption {
+	return func(options *clientOptions) {
+		options.TLSCertificates = append(options.TLSCertificates, cert)
+	}
+}
+
+// WithTLSClientCertificateFiles is a functional option for
+// xhttp.NewClient loading the client certificate from the PEM encoded
+// files certFile and keyFile. See WithTLSClientCertificate.
+func WithTLSClientCertificateFiles(certFile, keyFile string) ClientOption {
+	return func(options *clientOptions) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			options.err = fmt.Errorf("xhttp: loading client certificate (%w)", err)
+			return
+		}
+		WithTLSClientCertificate(cert)(options)
+	}
+}
+
+// WithTLSMinVersion is a functional option for xhttp.NewClient setting
+// the minimum TLS version, for example tls.VersionTLS13. Default is
+// TLS 1.2.
+func WithTLSMinVersion(v uint16) ClientOption {
+	return func(options *clientOptions) {
+		options.TLSMinVersion = v
+	}
+}
+
+// WithTLSServerName is a functional option for xhttp.NewClient setting
+// the server name sent using SNI, and used to verify the certificate of
+// the server. By default, the host of the request is used.
+func WithTLSServerName(name string) ClientOption {
+	return func(options *clientOptions) {
+		options.TLSServerName = name
+	}
+}
+
+// WithRoundTripper is a functional option for xhttp.NewClient sending
+// requests using rt instead of the HTTP transport of the client. Other
+// options, like authentication and retries, still apply, but TLS options
+// do not. It is used, for example, with xhttptest.Recorder.
+func WithRoundTripper(rt http.RoundTripper) ClientOption {
+	return func(options *clientOptions) {
+		options.RoundTripper = rt
+	}
+}
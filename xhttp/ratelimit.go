@@ -0,0 +1,231 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitIdleTimeout = 10 * time.Minute
+	defaultRateLimitMaxKeys     = 100000
+)
+
+// RateLimitKeyFunc returns the key for which request r is rate limited.
+// When the empty string is returned, r is not limited.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByIP is a RateLimitKeyFunc returning the IP address of the client
+// as found in the RemoteAddr field of the request. When the server is
+// behind a proxy, use a function reading the header set by the proxy.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByBearerToken is a RateLimitKeyFunc returning the bearer token found
+// in the HTTP Authorization header. The token is hashed so it is not kept
+// in memory. When there is no bearer token, the IP address of the client
+// is used (see KeyByIP).
+func KeyByBearerToken(r *http.Request) string {
+	token := bearerToken(r)
+	if token == "" {
+		return KeyByIP(r)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the token of the HTTP Authorization header using the
+// Bearer scheme, or an empty string.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get(HeaderAuthorization)
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// RateLimitOptions configures the middleware returned by RateLimit.
+type RateLimitOptions struct {
+	// Rate is the number of requests per second allowed for each key.
+	Rate float64
+
+	// Burst is the maximum number of requests which can be done at once.
+	// Defaults to the Rate rounded up, with a minimum of 1.
+	Burst int
+
+	// Key returns the key of the request. Defaults to KeyByIP.
+	Key RateLimitKeyFunc
+
+	// IdleTimeout is how long the state of a key is kept after its last
+	// request. Defaults to 10 minutes.
+	IdleTimeout time.Duration
+
+	// MaxKeys is the maximum number of keys kept in memory. When reached,
+	// the least recently used keys are evicted. Defaults to 100000.
+	MaxKeys int
+}
+
+// RateLimit returns middleware limiting the rate of requests for each key
+// using a token bucket: each key starts with Burst tokens, each request
+// takes a token, and tokens are added at Rate per second. Requests which
+// find the bucket empty are answered with HTTP status 429 and the
+// Retry-After header.
+//
+// The state is kept in memory, so limits apply per process. Keys which
+// were not used for the idle timeout are evicted.
+//
+// For example, allowing 5 requests per second for each bearer token with
+// bursts of 20 requests:
+//
+//     mux.Use(xhttp.RateLimit(xhttp.RateLimitOptions{
+//         Rate:  5,
+//         Burst: 20,
+//         Key:   xhttp.KeyByBearerToken,
+//     }))
+func RateLimit(opts RateLimitOptions) Middleware {
+	rl := newRateLimiter(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := rl.opts.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if wait, ok := rl.allow(key); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				Error(w, r, http.StatusTooManyRequests, "429 too many requests", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps the token buckets in a list ordered by their last
+// use, most recent first, so evicting is done in constant time.
+type rateLimiter struct {
+	opts RateLimitOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+func newRateLimiter(opts RateLimitOptions) *rateLimiter {
+	if opts.Rate <= 0 {
+		panic("xhttp: rate limit must be larger than zero")
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = int(math.Ceil(opts.Rate))
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultRateLimitIdleTimeout
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = defaultRateLimitMaxKeys
+	}
+
+	return &rateLimiter{
+		opts:    opts,
+		now:     time.Now,
+		buckets: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// allow takes a token from the bucket of key. When the bucket is empty,
+// it returns false and how long to wait for the next token.
+func (rl *rateLimiter) allow(key string) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	_, have := rl.buckets[key]
+	rl.evict(now, !have)
+
+	var b *tokenBucket
+	if e, ok := rl.buckets[key]; ok {
+		rl.lru.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+	} else {
+		b = &tokenBucket{key: key, tokens: float64(rl.opts.Burst), last: now}
+		rl.buckets[key] = rl.lru.PushFront(b)
+	}
+
+	b.tokens = math.Min(float64(rl.opts.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.opts.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rl.opts.Rate * float64(time.Second)), false
+	}
+
+	b.tokens--
+	return 0, true
+}
+
+// evict removes the buckets which were idle for longer than the idle
+// timeout and, when a key is added, the least recently used buckets when
+// there are too many keys. Must be called holding the lock.
+func (rl *rateLimiter) evict(now time.Time, adding bool) {
+	for e := rl.lru.Back(); e != nil; e = rl.lru.Back() {
+		b := e.Value.(*tokenBucket)
+		if now.Sub(b.last) < rl.opts.IdleTimeout && (!adding || len(rl.buckets) < rl.opts.MaxKeys) {
+			return
+		}
+		rl.lru.Remove(e)
+		delete(rl.buckets, b.key)
+	}
+}
+
+// MaxInFlight returns middleware limiting the number of requests which
+// are handled at the same time to n. Requests exceeding the limit are
+// answered immediately with HTTP status 503 and the Retry-After header.
+func MaxInFlight(n int) Middleware {
+	if n <= 0 {
+		panic("xhttp: maximum number of requests in flight must be larger than zero")
+	}
+
+	sem := make(chan struct{}, n)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				w.Header().Set("Retry-After", "1")
+				Error(w, r, http.StatusServiceUnavailable, "503 service unavailable", nil)
+				return
+			}
+			defer func() { <-sem }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
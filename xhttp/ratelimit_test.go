@@ -0,0 +1,119 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestRateLimit(t *testing.T) {
+	mux := NewServeReMux()
+	mux.Use(RateLimit(RateLimitOptions{Rate: 1, Burst: 2}))
+	mux.Handle(`^/persons$`, pathEchoHandler{})
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/persons", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	xt.Eq(t, http.StatusOK, serve("192.0.2.1:1234").Code)
+	xt.Eq(t, http.StatusOK, serve("192.0.2.1:1235").Code)
+
+	rr := serve("192.0.2.1:1236")
+	xt.Eq(t, http.StatusTooManyRequests, rr.Code)
+	xt.Eq(t, "1", rr.Header().Get("Retry-After"))
+
+	xt.Eq(t, http.StatusOK, serve("192.0.2.2:1234").Code, "other client")
+}
+
+func TestRateLimiter_allow(t *testing.T) {
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	rl := newRateLimiter(RateLimitOptions{Rate: 2, Burst: 2, IdleTimeout: time.Minute, MaxKeys: 3})
+	rl.now = func() time.Time { return now }
+
+	t.Run("refill", func(t *testing.T) {
+		_, ok := rl.allow("a")
+		xt.Assert(t, ok)
+		_, ok = rl.allow("a")
+		xt.Assert(t, ok)
+
+		wait, ok := rl.allow("a")
+		xt.Assert(t, !ok)
+		xt.Eq(t, 500*time.Millisecond, wait)
+
+		now = now.Add(500 * time.Millisecond)
+		_, ok = rl.allow("a")
+		xt.Assert(t, ok)
+	})
+
+	t.Run("evict idle keys", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		_, _ = rl.allow("b")
+		xt.Eq(t, 1, len(rl.buckets))
+	})
+
+	t.Run("evict least recently used", func(t *testing.T) {
+		for _, key := range []string{"c", "d", "e"} {
+			now = now.Add(time.Second)
+			_, _ = rl.allow(key)
+		}
+		xt.Eq(t, 3, len(rl.buckets))
+		_, have := rl.buckets["b"]
+		xt.Assert(t, !have)
+
+		now = now.Add(time.Second)
+		_, _ = rl.allow("c")
+		_, _ = rl.allow("f")
+		xt.Eq(t, 3, len(rl.buckets))
+		_, have = rl.buckets["c"]
+		xt.Assert(t, have, "recently used key was evicted")
+		_, have = rl.buckets["d"]
+		xt.Assert(t, !have)
+	})
+}
+
+func TestKeyByBearerToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	xt.Eq(t, "ip:192.0.2.1", KeyByBearerToken(req))
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	key := KeyByBearerToken(req)
+	xt.Assert(t, key != "ip:192.0.2.1")
+	xt.Eq(t, 70, len(key))
+}
+
+func TestMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	h := MaxInFlight(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-started
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	xt.Eq(t, http.StatusServiceUnavailable, rr.Code)
+	xt.Eq(t, "1", rr.Header().Get("Retry-After"))
+
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// maxStatusErrorBody is the maximum number of bytes of the response body
+// kept in StatusError.
+const maxStatusErrorBody = 64 << 10
+
+// StatusError is returned by Request.Do when the server replied with an
+// HTTP status code which is not 2xx.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body holds the response body, truncated to 64 KiB.
+	Body []byte
+}
+
+// Error returns the error as string.
+func (e *StatusError) Error() string {
+	msg := "xhttp: server replied with " + e.Status
+	if body := strings.TrimSpace(string(e.Body)); body != "" {
+		if len(body) > 200 {
+			body = body[:200] + "..."
+		}
+		msg += " (" + body + ")"
+	}
+	return msg
+}
+
+// Request is an HTTP request made using Client, and is built using
+// chained calls. Errors are kept and returned by Do. Use Client.NewRequest
+// to instantiate.
+type Request struct {
+	client *Client
+	ctx    context.Context
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	err    error
+}
+
+// NewRequest returns a new Request using method with ctx. The path is
+// resolved against the URI of c, which is always considered a directory:
+// when the URI is `https://example.com/api`, the path `users` resolves to
+// `https://example.com/api/users`, and `/users` to
+// `https://example.com/users`. The path can also be an absolute URL.
+//
+// For example:
+//
+//     var user User
+//     _, err := c.NewRequest(ctx, http.MethodGet, "users/1234").
+//         Query("fields", "name,email").
+//         Header("Accept-Language", "en").
+//         Do(&user)
+func (c *Client) NewRequest(ctx context.Context, method, path string) *Request {
+	return &Request{
+		client: c,
+		ctx:    ctx,
+		method: method,
+		path:   path,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+// Query adds the query parameter key with value.
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Header sets the HTTP header key to value.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// JSON encodes v as JSON and uses it as request body.
+func (r *Request) JSON(v interface{}) *Request {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.err = fmt.Errorf("xhttp: encoding request body (%w)", err)
+		return r
+	}
+	return r.Body(ContentTypeJSON, data)
+}
+
+// Body uses body as request body with the given content type.
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.body = body
+	r.header.Set(HeaderContentType, contentType)
+	return r
+}
+
+// Form uses values, URL-encoded, as request body with the content type
+// `application/x-www-form-urlencoded`.
+func (r *Request) Form(values url.Values) *Request {
+	return r.Body(ContentTypeForm, []byte(values.Encode()))
+}
+
+// FormFile is a file sent using a multipart/form-data request body. When
+// ContentType is empty, `application/octet-stream` is used.
+type FormFile struct {
+	Field       string
+	FileName    string
+	ContentType string
+	Content     io.Reader
+}
+
+// Multipart uses a multipart/form-data request body containing values and
+// files. The complete body is kept in memory.
+func (r *Request) Multipart(values url.Values, files ...FormFile) *Request {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range values[k] {
+			if err := mw.WriteField(k, v); err != nil {
+				r.err = fmt.Errorf("xhttp: encoding multipart body (%w)", err)
+				return r
+			}
+		}
+	}
+
+	for _, f := range files {
+		ct := f.ContentType
+		if ct == "" {
+			ct = ContentTypeBinary
+		}
+
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     f.Field,
+			"filename": f.FileName,
+		}))
+		h.Set(HeaderContentType, ct)
+
+		part, err := mw.CreatePart(h)
+		if err == nil {
+			_, err = io.Copy(part, f.Content)
+		}
+		if err != nil {
+			r.err = fmt.Errorf("xhttp: encoding multipart body (%w)", err)
+			return r
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		r.err = fmt.Errorf("xhttp: encoding multipart body (%w)", err)
+		return r
+	}
+
+	return r.Body(mw.FormDataContentType(), buf.Bytes())
+}
+
+// URL returns the URL of the request, with the query parameters.
+func (r *Request) URL() (*url.URL, error) {
+	base, err := url.Parse(r.client.URI)
+	if err != nil {
+		return nil, fmt.Errorf("xhttp: parsing client URI (%w)", err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		if base.RawPath != "" {
+			base.RawPath += "/"
+		}
+	}
+
+	ref, err := url.Parse(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("xhttp: parsing request path (%w)", err)
+	}
+
+	u := base.ResolveReference(ref)
+	if len(r.query) > 0 {
+		q := u.Query()
+		for k, values := range r.query {
+			for _, v := range values {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u, nil
+}
+
+// HTTPRequest returns r as http.Request.
+func (r *Request) HTTPRequest() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	u, err := r.URL()
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, r.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+
+	return req, nil
+}
+
+// Do sends the request. When the server replies with an HTTP status code
+// which is not 2xx, the error is *StatusError. Otherwise, when v is not
+// nil, the response body is decoded into v according to its content type:
+// JSON (also when there is no content type) or XML. When v is *[]byte,
+// *string, or io.Writer, the body is stored as is.
+// The response is returned, but its body is already read and closed.
+func (r *Request) Do(v interface{}) (*http.Response, error) {
+	req, err := r.HTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStatusErrorBody))
+		return resp, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       body,
+		}
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp, nil
+	}
+
+	if err := decodeResponse(resp, v); err != nil {
+		return resp, fmt.Errorf("xhttp: decoding response body (%w)", err)
+	}
+
+	return resp, nil
+}
+
+// decodeResponse decodes the body of resp into v.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	switch v := v.(type) {
+	case *[]byte:
+		data, err := io.ReadAll(resp.Body)
+		*v = data
+		return err
+	case *string:
+		data, err := io.ReadAll(resp.Body)
+		*v = string(data)
+		return err
+	case io.Writer:
+		_, err := io.Copy(v, resp.Body)
+		return err
+	}
+
+	ct := resp.Header.Get(HeaderContentType)
+	if ct == "" {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return json.NewDecoder(resp.Body).Decode(v)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return xml.NewDecoder(resp.Body).Decode(v)
+	}
+
+	return fmt.Errorf("unsupported content type %s", mediaType)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestClient_NewRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"title":"not found"}`))
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = WriteJSON(w, http.StatusOK, map[string]string{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"query":  r.URL.RawQuery,
+			"lang":   r.Header.Get("Accept-Language"),
+			"body":   string(body),
+		})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL + "/api")
+	ctx := context.Background()
+
+	t.Run("resolve path", func(t *testing.T) {
+		cases := map[string]string{
+			"users":      server.URL + "/api/users",
+			"/users":     server.URL + "/users",
+			"users/?a=1": server.URL + "/api/users/?a=1",
+			"":           server.URL + "/api/",
+		}
+		for path, exp := range cases {
+			t.Run(path, func(t *testing.T) {
+				u, err := c.NewRequest(ctx, http.MethodGet, path).URL()
+				xt.OK(t, err)
+				xt.Eq(t, exp, u.String())
+			})
+		}
+	})
+
+	t.Run("query, header and JSON", func(t *testing.T) {
+		var got map[string]string
+		resp, err := c.NewRequest(ctx, http.MethodPost, "users").
+			Query("fields", "name").
+			Query("fields", "email").
+			Header("Accept-Language", "nl").
+			JSON(map[string]string{"name": "alice"}).
+			Do(&got)
+		xt.OK(t, err)
+		xt.Eq(t, http.StatusOK, resp.StatusCode)
+
+		xt.Eq(t, map[string]string{
+			"method": http.MethodPost,
+			"path":   "/api/users",
+			"query":  "fields=name&fields=email",
+			"lang":   "nl",
+			"body":   `{"name":"alice"}`,
+		}, got)
+	})
+
+	t.Run("status error", func(t *testing.T) {
+		_, err := c.NewRequest(ctx, http.MethodGet, "missing").Do(nil)
+		xt.KO(t, err)
+
+		var se *StatusError
+		xt.Assert(t, errors.As(err, &se))
+		xt.Eq(t, http.StatusNotFound, se.StatusCode)
+		xt.Eq(t, `{"title":"not found"}`, string(se.Body))
+		xt.Eq(t, `xhttp: server replied with 404 Not Found ({"title":"not found"})`, se.Error())
+	})
+
+	t.Run("JSON encoding error", func(t *testing.T) {
+		_, err := c.NewRequest(ctx, http.MethodPost, "users").JSON(make(chan int)).Do(nil)
+		xt.KO(t, err)
+	})
+
+	t.Run("form", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			_, _ = w.Write([]byte(r.Header.Get(HeaderContentType) + " " + r.PostForm.Encode()))
+		}))
+		defer srv.Close()
+
+		var got string
+		_, err := NewClient(srv.URL).NewRequest(ctx, http.MethodPost, "").
+			Form(url.Values{"name": {"alice"}, "tags": {"a", "b"}}).
+			Do(&got)
+		xt.OK(t, err)
+		xt.Eq(t, "application/x-www-form-urlencoded name=alice&tags=a&tags=b", got)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f, fh, err := r.FormFile("upload")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			content, _ := ioutil.ReadAll(f)
+			_ = WriteJSON(w, http.StatusOK, map[string]string{
+				"name":        r.FormValue("name"),
+				"fileName":    fh.Filename,
+				"contentType": fh.Header.Get(HeaderContentType),
+				"content":     string(content),
+			})
+		}))
+		defer srv.Close()
+
+		var got map[string]string
+		_, err := NewClient(srv.URL).NewRequest(ctx, http.MethodPost, "").
+			Multipart(url.Values{"name": {"report"}}, FormFile{
+				Field:       "upload",
+				FileName:    "report.csv",
+				ContentType: "text/csv",
+				Content:     strings.NewReader("a,b\n1,2\n"),
+			}).
+			Do(&got)
+		xt.OK(t, err)
+		xt.Eq(t, map[string]string{
+			"name":        "report",
+			"fileName":    "report.csv",
+			"contentType": "text/csv",
+			"content":     "a,b\n1,2\n",
+		}, got)
+	})
+
+	t.Run("decode by content type", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/xml":
+				w.Header().Set(HeaderContentType, "application/xml")
+				_, _ = w.Write([]byte(`<person><name>alice</name></person>`))
+			case "/problem":
+				w.Header().Set(HeaderContentType, ContentTypeProblemJSON)
+				_, _ = w.Write([]byte(`{"name":"bob"}`))
+			default:
+				w.Header().Set(HeaderContentType, ContentTypePlain)
+				_, _ = w.Write([]byte(`carol`))
+			}
+		}))
+		defer srv.Close()
+
+		type person struct {
+			Name string `json:"name" xml:"name"`
+		}
+		c := NewClient(srv.URL)
+
+		var p person
+		_, err := c.NewRequest(ctx, http.MethodGet, "xml").Do(&p)
+		xt.OK(t, err)
+		xt.Eq(t, "alice", p.Name)
+
+		_, err = c.NewRequest(ctx, http.MethodGet, "problem").Do(&p)
+		xt.OK(t, err)
+		xt.Eq(t, "bob", p.Name)
+
+		_, err = c.NewRequest(ctx, http.MethodGet, "text").Do(&p)
+		xt.KO(t, err)
+		xt.Match(t, ".*unsupported content type text/plain", err.Error())
+
+		var raw []byte
+		_, err = c.NewRequest(ctx, http.MethodGet, "text").Do(&raw)
+		xt.OK(t, err)
+		xt.Eq(t, "carol", string(raw))
+	})
+}
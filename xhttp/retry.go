@@ -0,0 +1,208 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+	defaultRetryMultiplier     = 2.0
+	defaultRetryJitter         = 0.2
+)
+
+var defaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy configures how requests made by Client are retried. Zero
+// values are replaced with defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is how long to wait before the first retry. Defaults
+	// to 100 milliseconds.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum time to wait between attempts, which also
+	// limits the time used from the Retry-After header. Defaults to 10
+	// seconds.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the backoff grows after each
+	// attempt. Defaults to 2.
+	Multiplier float64
+
+	// Jitter is the fraction, between 0 and 1, of the backoff which is
+	// randomly subtracted so that clients do not retry at the same time.
+	// Defaults to 0.2. Use a negative value to disable.
+	Jitter float64
+
+	// RetryStatus lists the HTTP status codes which are retried. Defaults
+	// to 429, 502, 503, and 504.
+	RetryStatus []int
+
+	// RetryNonIdempotent allows retrying requests using methods which are
+	// not idempotent, like POST and PATCH. Regardless, such requests are
+	// retried when they have an Idempotency-Key header.
+	RetryNonIdempotent bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	switch {
+	case p.Jitter == 0:
+		p.Jitter = defaultRetryJitter
+	case p.Jitter < 0:
+		p.Jitter = 0
+	case p.Jitter > 1:
+		p.Jitter = 1
+	}
+	if p.RetryStatus == nil {
+		p.RetryStatus = defaultRetryStatus
+	}
+	return p
+}
+
+// backoff returns how long to wait before attempt, which starts at 1 for
+// the first retry.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// retryable returns whether req can be retried.
+func (p RetryPolicy) retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return p.RetryNonIdempotent || req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryStatus returns whether a response with status is retried.
+func (p RetryPolicy) retryStatus(status int) bool {
+	for _, s := range p.RetryStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// roundTripRetry sends req using rt, retrying according to p. The body
+// of req is buffered in memory when it can not be retrieved again using
+// the GetBody field of req.
+func (p RetryPolicy) roundTripRetry(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if !p.retryable(req) {
+		return rt.RoundTrip(req)
+	}
+
+	if req.GetBody == nil {
+		if _, err := requestBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := rt.RoundTrip(req)
+		if attempt >= p.MaxAttempts {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+				errors.Is(err, ErrCircuitOpen) {
+				return nil, err
+			}
+			wait = p.backoff(attempt)
+		case p.retryStatus(resp.StatusCode):
+			wait = p.backoff(attempt)
+			if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = ra
+				if wait > p.MaxBackoff {
+					wait = p.MaxBackoff
+				}
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter parses the value of the Retry-After header, which is
+// either a number of seconds or an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
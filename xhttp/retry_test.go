@@ -0,0 +1,180 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+	}
+
+	// failing returns a server failing the first n requests with status,
+	// and then echoing the request body.
+	failing := func(n int32, status int, header http.Header) (*httptest.Server, *int32) {
+		var count int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if atomic.AddInt32(&count, 1) <= n {
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(status)
+				return
+			}
+			_, _ = w.Write(body)
+		}))
+		return srv, &count
+	}
+
+	t.Run("retries status and replays body", func(t *testing.T) {
+		srv, count := failing(2, http.StatusServiceUnavailable, nil)
+		defer srv.Close()
+
+		c := NewClient(srv.URL, WithRetry(policy))
+		req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+		xt.OK(t, err)
+		req.GetBody = nil // force buffering by the client
+
+		resp, err := c.Do(req)
+		xt.OK(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := ioutil.ReadAll(resp.Body)
+		xt.OK(t, err)
+
+		xt.Eq(t, http.StatusOK, resp.StatusCode)
+		xt.Eq(t, "payload", string(body))
+		xt.Eq(t, int32(3), atomic.LoadInt32(count))
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		srv, count := failing(5, http.StatusBadGateway, nil)
+		defer srv.Close()
+
+		resp, err := NewClient(srv.URL, WithRetry(policy)).Get()
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, http.StatusBadGateway, resp.StatusCode)
+		xt.Eq(t, int32(3), atomic.LoadInt32(count))
+	})
+
+	t.Run("status not retried", func(t *testing.T) {
+		srv, count := failing(1, http.StatusInternalServerError, nil)
+		defer srv.Close()
+
+		resp, err := NewClient(srv.URL, WithRetry(policy)).Get()
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, http.StatusInternalServerError, resp.StatusCode)
+		xt.Eq(t, int32(1), atomic.LoadInt32(count))
+	})
+
+	t.Run("POST not retried", func(t *testing.T) {
+		srv, count := failing(1, http.StatusServiceUnavailable, nil)
+		defer srv.Close()
+
+		resp, err := NewClient(srv.URL, WithRetry(policy)).Post(bytes.NewReader([]byte("x")))
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, http.StatusServiceUnavailable, resp.StatusCode)
+		xt.Eq(t, int32(1), atomic.LoadInt32(count))
+	})
+
+	t.Run("POST with Idempotency-Key", func(t *testing.T) {
+		srv, count := failing(1, http.StatusServiceUnavailable, nil)
+		defer srv.Close()
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("x"))
+		xt.OK(t, err)
+		req.Header.Set("Idempotency-Key", "8e03978e")
+
+		resp, err := NewClient(srv.URL, WithRetry(policy)).Do(req)
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, http.StatusOK, resp.StatusCode)
+		xt.Eq(t, int32(2), atomic.LoadInt32(count))
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		srv, _ := failing(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+		defer srv.Close()
+
+		p := policy
+		p.MaxBackoff = 50 * time.Millisecond
+		start := time.Now()
+		resp, err := NewClient(srv.URL, WithRetry(p)).Get()
+		xt.OK(t, err)
+		_ = resp.Body.Close()
+		xt.Eq(t, http.StatusOK, resp.StatusCode)
+		elapsed := time.Since(start)
+		xt.Assert(t, elapsed >= 50*time.Millisecond && elapsed < time.Second, elapsed.String())
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		url := srv.URL
+		srv.Close()
+
+		p := policy
+		p.MaxAttempts = 2
+		_, err := NewClient(url, WithRetry(p)).Get()
+		xt.KO(t, err)
+	})
+
+	t.Run("context canceled while waiting", func(t *testing.T) {
+		srv, count := failing(5, http.StatusServiceUnavailable, http.Header{"Retry-After": {"5"}})
+		defer srv.Close()
+
+		p := policy
+		p.MaxBackoff = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		xt.OK(t, err)
+
+		_, err = NewClient(srv.URL, WithRetry(p)).Do(req)
+		xt.KO(t, err)
+		xt.Eq(t, int32(1), atomic.LoadInt32(count))
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: -1}.withDefaults()
+	xt.Eq(t, time.Second, p.backoff(1))
+	xt.Eq(t, 2*time.Second, p.backoff(2))
+	xt.Eq(t, 4*time.Second, p.backoff(3))
+	xt.Eq(t, 5*time.Second, p.backoff(4))
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := p.backoff(1)
+		xt.Assert(t, d > 500*time.Millisecond && d <= time.Second, d.String())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("120")
+	xt.Assert(t, ok)
+	xt.Eq(t, 2*time.Minute, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	xt.Assert(t, ok)
+	xt.Assert(t, d > 59*time.Minute && d <= time.Hour, d.String())
+
+	_, ok = parseRetryAfter("soon")
+	xt.Assert(t, !ok)
+}
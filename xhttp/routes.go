@@ -0,0 +1,121 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Route describes a route registered with ServeReMux.
+type Route struct {
+	Name     string         `json:"name,omitempty"`
+	Pattern  string         `json:"pattern"`
+	Regex    string         `json:"regex"`
+	Regexp   *regexp.Regexp `json:"-"`
+	Methods  []Method       `json:"methods"`
+	Captures []Capture      `json:"captures,omitempty"`
+}
+
+// String returns the methods, pattern, and optional name of r as a
+// string. This is useful when logging the routes.
+func (r Route) String() string {
+	methods := make([]string, len(r.Methods))
+	for i, m := range r.Methods {
+		methods[i] = string(m)
+	}
+
+	s := strings.Join(methods, ",") + " " + r.Pattern
+	if r.Name != "" {
+		s += " (" + r.Name + ")"
+	}
+	return s
+}
+
+// Routes returns the routes registered with s in the order in which
+// they are matched. Routes of a mounted ServeReMux are included using
+// the mount prefix in their pattern and regular expression; the mounts
+// themselves are not returned.
+// When no methods were used registering a route, the methods of the
+// returned Route contains GET.
+func (s *ServeReMux) Routes() []Route {
+	var routes []Route
+
+	for _, v := range s.handlers.Values() {
+		h, ok := v.(*reHandler)
+		if !ok {
+			continue
+		}
+
+		if sub, ok := h.handler.(*ServeReMux); ok {
+			for _, r := range sub.Routes() {
+				if h.mounted != nil {
+					if r = h.mountedRoute(r); len(r.Methods) == 0 {
+						continue // not reachable through the mount
+					}
+				}
+				routes = append(routes, r)
+			}
+
+			if h.mounted != nil {
+				continue
+			}
+		}
+
+		methods := h.methods
+		if len(methods) == 0 {
+			methods = []Method{MethodGet}
+		}
+
+		routes = append(routes, Route{
+			Name:     h.name,
+			Pattern:  h.pattern,
+			Regex:    h.regex,
+			Regexp:   h.compiled,
+			Methods:  append([]Method{}, methods...),
+			Captures: patternCaptures(h.pattern),
+		})
+	}
+
+	return routes
+}
+
+// mountedRoute returns r as if it was registered using the mount prefix
+// of h.
+func (h reHandler) mountedRoute(r Route) Route {
+	r.Pattern = joinPatterns(h.pattern, r.Pattern)
+	r.Regex = joinPatterns(h.regex, r.Regex)
+	r.Regexp, _ = regexp.Compile(r.Regex)
+	r.Captures = patternCaptures(r.Pattern)
+
+	if len(h.methods) > 0 {
+		var methods []Method
+		for _, m := range r.Methods {
+			if h.allowedMethod(m) {
+				methods = append(methods, m)
+			}
+		}
+		r.Methods = methods
+	}
+
+	return r
+}
+
+// patternCaptures returns the captures found in pattern in the order
+// they appear.
+func patternCaptures(pattern string) []Capture {
+	var captures []Capture
+
+	for _, m := range reCaptures.FindAllStringSubmatch(pattern, -1) {
+		conv := m[2]
+		if conv == "" {
+			conv = defaultCaptureConverter
+		}
+		captures = append(captures, Capture{
+			Name:      m[3],
+			Converter: conv,
+		})
+	}
+
+	return captures
+}
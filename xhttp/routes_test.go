@@ -0,0 +1,56 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestServeReMux_Routes(t *testing.T) {
+	api := NewServeReMux()
+	api.HandleNamed("member", `^/members/<int:id>$`, pathEchoHandler{}, MethodGet, MethodPost)
+	api.Handle(`^/members$`, pathEchoHandler{}, MethodPost)
+
+	mux := NewServeReMux()
+	mux.HandleNamed("home", `^/$`, pathEchoHandler{})
+	mux.Mount(`^/org/<orgUID>/api`, api, MethodGet)
+
+	routes := mux.Routes()
+	xt.Eq(t, 2, len(routes))
+
+	t.Run("route registered with mux", func(t *testing.T) {
+		r := routes[0]
+		xt.Eq(t, "home", r.Name)
+		xt.Eq(t, `^/$`, r.Pattern)
+		xt.Eq(t, []Method{MethodGet}, r.Methods)
+		xt.Eq(t, 0, len(r.Captures))
+		xt.Eq(t, "GET ^/$ (home)", r.String())
+	})
+
+	t.Run("route of mounted mux", func(t *testing.T) {
+		r := routes[1]
+		xt.Eq(t, "member", r.Name)
+		xt.Eq(t, `^/org/<orgUID>/api/members/<int:id>$`, r.Pattern)
+		xt.Eq(t, `^/org/(?P<orgUID>[\w-_]+)/api/members/(?P<id>\d{1,19})$`, r.Regex)
+		xt.Assert(t, r.Regexp.MatchString("/org/acme/api/members/42"))
+		xt.Eq(t, []Method{MethodGet}, r.Methods)
+		xt.Eq(t, []Capture{
+			{Name: "orgUID", Converter: "str"},
+			{Name: "id", Converter: "int"},
+		}, r.Captures)
+	})
+
+	t.Run("prefix ending with slash", func(t *testing.T) {
+		v2 := NewServeReMux()
+		v2.HandleNamed("version", `^/version$`, pathEchoHandler{})
+		mux := NewServeReMux()
+		mux.Mount(`^/v2/`, v2)
+
+		routes := mux.Routes()
+		xt.Eq(t, 1, len(routes))
+		xt.Eq(t, `^/v2/version$`, routes[0].Pattern)
+		xt.Eq(t, `^/v2/version$`, routes[0].Regex)
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecurityHeadersOptions configures the middleware returned by
+// SecurityHeaders. Headers with empty values are not set.
+type SecurityHeadersOptions struct {
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header,
+	// which is only sent for requests using TLS. When zero, the header is
+	// not sent.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ContentSecurityPolicy is the value of the Content-Security-Policy
+	// header, for example `default-src 'self'`.
+	ContentSecurityPolicy string
+
+	// FrameOptions is the value of the X-Frame-Options header. Defaults
+	// to DENY.
+	FrameOptions string
+
+	// ReferrerPolicy is the value of the Referrer-Policy header. Defaults
+	// to strict-origin-when-cross-origin.
+	ReferrerPolicy string
+}
+
+// SecurityHeaders returns middleware setting HTTP response headers which
+// improve security in browsers. The X-Content-Type-Options header is
+// always set to nosniff.
+//
+// A request is considered using TLS when the connection uses TLS, or
+// when the X-Forwarded-Proto header is https.
+func SecurityHeaders(opts SecurityHeadersOptions) Middleware {
+	if opts.FrameOptions == "" {
+		opts.FrameOptions = "DENY"
+	}
+	if opts.ReferrerPolicy == "" {
+		opts.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+
+	var hsts string
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge.Seconds()))
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if opts.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hdr := w.Header()
+			hdr.Set("X-Content-Type-Options", "nosniff")
+			hdr.Set("X-Frame-Options", opts.FrameOptions)
+			hdr.Set("Referrer-Policy", opts.ReferrerPolicy)
+
+			if opts.ContentSecurityPolicy != "" {
+				hdr.Set("Content-Security-Policy", opts.ContentSecurityPolicy)
+			}
+
+			if hsts != "" && (r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")) {
+				hdr.Set("Strict-Transport-Security", hsts)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	h := SecurityHeaders(SecurityHeadersOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'self'",
+	})(pathEchoHandler{})
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		xt.Eq(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		xt.Eq(t, "DENY", rr.Header().Get("X-Frame-Options"))
+		xt.Eq(t, "strict-origin-when-cross-origin", rr.Header().Get("Referrer-Policy"))
+		xt.Eq(t, "default-src 'self'", rr.Header().Get("Content-Security-Policy"))
+		xt.Eq(t, "", rr.Header().Get("Strict-Transport-Security"))
+	})
+
+	t.Run("HSTS using TLS", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		xt.Eq(t, "max-age=31536000; includeSubDomains", rr.Header().Get("Strict-Transport-Security"))
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		xt.Eq(t, "max-age=31536000; includeSubDomains", rr.Header().Get("Strict-Transport-Security"))
+	})
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xlog"
+	"github.com/geertjanvdk/xkit/xutil"
+)
+
+const (
+	defaultDrainTimeout       = 15 * time.Second
+	defaultHealthCheckTimeout = 5 * time.Second
+)
+
+// HealthCheck checks the health of a dependency, for example a database.
+// It returns an error when the dependency is not healthy. For example,
+// the PingContext method of xsql.DB can be used as HealthCheck.
+type HealthCheck func(ctx context.Context) error
+
+// ServerOption is the functional option type used with
+// xhttp.NewServer.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	Mux                *ServeReMux
+	Logger             *xlog.Logger
+	DrainTimeout       time.Duration
+	HealthCheckTimeout time.Duration
+}
+
+func newServerOptions() *serverOptions {
+	return &serverOptions{
+		DrainTimeout:       defaultDrainTimeout,
+		HealthCheckTimeout: defaultHealthCheckTimeout,
+	}
+}
+
+// WithServeReMux is a functional option for xhttp.NewServer setting the
+// multiplexer used by the server. By default, a new ServeReMux is used.
+func WithServeReMux(mux *ServeReMux) ServerOption {
+	return func(options *serverOptions) {
+		options.Mux = mux
+	}
+}
+
+// WithLogger is a functional option for xhttp.NewServer setting the
+// logger. By default, the xlog default logger is used.
+func WithLogger(l *xlog.Logger) ServerOption {
+	return func(options *serverOptions) {
+		options.Logger = l
+	}
+}
+
+// WithDrainTimeout is a functional option for xhttp.NewServer setting
+// how long the server waits for active connections to finish when
+// shutting down. Default is 15 seconds.
+func WithDrainTimeout(d time.Duration) ServerOption {
+	return func(options *serverOptions) {
+		options.DrainTimeout = d
+	}
+}
+
+// WithHealthCheckTimeout is a functional option for xhttp.NewServer
+// setting how long all health checks together can take. Default is 5
+// seconds.
+func WithHealthCheckTimeout(d time.Duration) ServerOption {
+	return func(options *serverOptions) {
+		options.HealthCheckTimeout = d
+	}
+}
+
+// Server wraps around Go's http.Server using ServeReMux as handler. It
+// registers the health endpoints `/healthz` (liveness) and `/readyz`
+// (readiness), and shuts down gracefully when receiving the SIGINT or
+// SIGTERM signal.
+type Server struct {
+	*http.Server
+	Mux *ServeReMux
+
+	options      *serverOptions
+	liveness     xutil.OrderedMap
+	readiness    xutil.OrderedMap
+	listenAddr   atomic.Value
+	shuttingDown int32
+}
+
+// NewServer instantiates Server listening on addr, with optional
+// functional options.
+func NewServer(addr string, options ...ServerOption) *Server {
+	opt := newServerOptions()
+	for _, o := range options {
+		o(opt)
+	}
+
+	if opt.Mux == nil {
+		opt.Mux = NewServeReMux()
+	}
+
+	s := &Server{
+		Mux:     opt.Mux,
+		options: opt,
+	}
+
+	s.Mux.HandleFunc("^/healthz$", s.handleLiveness, MethodGet, MethodHead)
+	s.Mux.HandleFunc("^/readyz$", s.handleReadiness, MethodGet, MethodHead)
+
+	s.Server = &http.Server{
+		Addr:    addr,
+		Handler: s.Mux,
+	}
+
+	return s
+}
+
+// AddHealthCheck adds a check which is run when the liveness endpoint
+// `/healthz` is requested. Checks with the same name are replaced.
+func (s *Server) AddHealthCheck(name string, check HealthCheck) {
+	s.liveness.Set(name, check)
+}
+
+// AddReadinessCheck adds a check which is run when the readiness endpoint
+// `/readyz` is requested. Checks with the same name are replaced.
+// For example, to check the database connection:
+//
+//     srv.AddReadinessCheck("database", db.PingContext)
+func (s *Server) AddReadinessCheck(name string, check HealthCheck) {
+	s.readiness.Set(name, check)
+}
+
+// ListenAddr returns the address the server is listening on. This is
+// useful when the port was not specified. Returns an empty string when
+// the server is not listening.
+func (s *Server) ListenAddr() string {
+	a, _ := s.listenAddr.Load().(string)
+	return a
+}
+
+// Run listens on the TCP network address of s and serves requests until
+// ctx is done, or until the SIGINT or SIGTERM signal is received. It then
+// shuts down gracefully, waiting for active connections to finish, but at
+// most the drain timeout. While shutting down, the readiness endpoint
+// returns HTTP status 503.
+// Returns nil when the server was shut down gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	addr := s.Server.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.serve(ctx, ln)
+}
+
+func (s *Server) serve(ctx context.Context, ln net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.listenAddr.Store(ln.Addr().String())
+	defer s.listenAddr.Store("")
+
+	s.log().WithField("addr", ln.Addr().String()).Info("HTTP server listening")
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Server.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	s.log().WithField("timeout", s.options.DrainTimeout).Info("HTTP server shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.options.DrainTimeout)
+	defer cancel()
+
+	if err := s.Server.Shutdown(shutdownCtx); err != nil {
+		s.log().WithError(err).Error("HTTP server failed shutting down gracefully")
+		_ = s.Server.Close()
+		return err
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	s.log().Info("HTTP server stopped")
+	return nil
+}
+
+func (s *Server) log() *xlog.Entry {
+	if s.options.Logger != nil {
+		return s.options.Logger.NewEntry()
+	}
+	return xlog.WithFields(xlog.Fields{})
+}
+
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, r, &s.liveness, false)
+}
+
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, r, &s.readiness, atomic.LoadInt32(&s.shuttingDown) == 1)
+}
+
+// writeHealth runs the checks and replies with the result. When any of
+// the checks fails, or the server is draining, HTTP status 503 is used.
+func (s *Server) writeHealth(w http.ResponseWriter, r *http.Request, checks *xutil.OrderedMap, draining bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.options.HealthCheckTimeout)
+	defer cancel()
+
+	doc := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}{
+		Status: "ok",
+	}
+
+	names, values := checks.KeysValues()
+	for i, name := range names {
+		if doc.Checks == nil {
+			doc.Checks = map[string]string{}
+		}
+
+		if err := values[i].(HealthCheck)(ctx); err != nil {
+			doc.Status = "failing"
+			doc.Checks[name] = err.Error()
+			s.log().WithError(err).WithField("check", name).Warn("health check failed")
+			continue
+		}
+		doc.Checks[name] = "ok"
+	}
+
+	status := http.StatusOK
+	switch {
+	case draining:
+		doc.Status = "draining"
+		status = http.StatusServiceUnavailable
+	case doc.Status != "ok":
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = WriteJSON(w, status, doc)
+}
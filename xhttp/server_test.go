@@ -0,0 +1,107 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xlog"
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func testServerLogger() (*xlog.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := xlog.New()
+	l.Out = buf
+	return l, buf
+}
+
+func TestServer_Health(t *testing.T) {
+	l, _ := testServerLogger()
+	srv := NewServer(":0", WithLogger(l))
+
+	get := func(p string) (int, map[string]interface{}) {
+		rr := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, p, nil))
+
+		var doc map[string]interface{}
+		xt.OK(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+		return rr.Code, doc
+	}
+
+	t.Run("no checks", func(t *testing.T) {
+		code, doc := get("/healthz")
+		xt.Eq(t, http.StatusOK, code)
+		xt.Eq(t, "ok", doc["status"])
+	})
+
+	t.Run("failing readiness check", func(t *testing.T) {
+		srv.AddReadinessCheck("database", func(ctx context.Context) error {
+			return errors.New("connection refused")
+		})
+		srv.AddReadinessCheck("cache", func(ctx context.Context) error {
+			return nil
+		})
+
+		code, doc := get("/readyz")
+		xt.Eq(t, http.StatusServiceUnavailable, code)
+		xt.Eq(t, "failing", doc["status"])
+		xt.Eq(t, map[string]interface{}{
+			"database": "connection refused",
+			"cache":    "ok",
+		}, doc["checks"])
+
+		code, _ = get("/healthz")
+		xt.Eq(t, http.StatusOK, code)
+	})
+}
+
+func TestServer_Run(t *testing.T) {
+	l, logBuf := testServerLogger()
+	srv := NewServer("127.0.0.1:0", WithLogger(l), WithDrainTimeout(time.Second))
+
+	srv.Mux.HandleFunc("^/slow$", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(ctx)
+	}()
+
+	for i := 0; i < 100 && srv.ListenAddr() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	addr := srv.ListenAddr()
+	xt.Assert(t, addr != "", "server not listening")
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := ioutil.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	xt.Eq(t, "done", <-body, "active request must be drained")
+	xt.OK(t, <-runErr)
+	xt.Eq(t, "", srv.ListenAddr())
+	xt.Match(t, `HTTP server listening.*`+addr, logBuf.String())
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSSERetryDelay = 3 * time.Second
+
+// SSEEvent is an event sent using Server-Sent Events.
+type SSEEvent struct {
+	// ID is the event ID. Clients send the last ID they received using
+	// the Last-Event-ID header when reconnecting.
+	ID string
+
+	// Event is the event type. When empty, clients use `message`.
+	Event string
+
+	// Data is the payload of the event. It can contain new lines.
+	Data string
+
+	// Retry, when not zero, tells clients how long to wait before
+	// reconnecting.
+	Retry time.Duration
+}
+
+// SSEWriter writes Server-Sent Events to the response of a handler. It is
+// safe for concurrent use. Use NewSSEWriter to instantiate.
+//
+// For example, sending progress updates:
+//
+//     mux.HandleFunc(`^/jobs/(?P<id>\w+)/progress$`, func(w http.ResponseWriter, r *http.Request) {
+//         sse, err := xhttp.NewSSEWriter(w, r)
+//         if err != nil {
+//             xhttp.InternalError(w, r)
+//             return
+//         }
+//         defer sse.Close()
+//         sse.Heartbeat(15 * time.Second)
+//
+//         for p := range progress {
+//             if err := sse.SendJSON("progress", p); err != nil {
+//                 return // client disconnected
+//             }
+//         }
+//     })
+type SSEWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+
+	mu     sync.Mutex
+	closed bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSSEWriter sets the headers of the response for Server-Sent Events,
+// sends them, and returns an SSEWriter. An error is returned when w does
+// not support http.Flusher.
+func NewSSEWriter(w http.ResponseWriter, r *http.Request) (*SSEWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("xhttp: response writer does not support flushing")
+	}
+
+	h := w.Header()
+	h.Set(HeaderContentType, ContentTypeSSE)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // nginx
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &SSEWriter{
+		w:       w,
+		flusher: flusher,
+		ctx:     r.Context(),
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Done returns a channel which is closed when the client disconnected.
+func (s *SSEWriter) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send sends ev and flushes it. An error is returned when the client
+// disconnected, when s is closed, or when the ID or type of ev contain
+// new lines.
+func (s *SSEWriter) Send(ev SSEEvent) error {
+	if strings.ContainsAny(ev.ID, "\r\n\x00") {
+		return errors.New("xhttp: SSE event ID contains new line or NUL")
+	}
+	if strings.ContainsAny(ev.Event, "\r\n") {
+		return errors.New("xhttp: SSE event type contains new line")
+	}
+
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(ev.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return s.write(b.String())
+}
+
+// SendJSON sends v encoded as JSON as data of an event with type event.
+func (s *SSEWriter) SendJSON(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("xhttp: encoding SSE data (%w)", err)
+	}
+	return s.Send(SSEEvent{Event: event, Data: string(data)})
+}
+
+// Comment sends a comment, which clients ignore. Comments can be used to
+// keep the connection open.
+func (s *SSEWriter) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Heartbeat sends a comment every interval so that proxies do not close
+// the idle connection. It stops when the client disconnects, or when s is
+// closed.
+func (s *SSEWriter) Heartbeat(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the heartbeat, and waits for it to finish. Nothing is sent
+// after Close returns, which must happen before the handler returns.
+func (s *SSEWriter) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *SSEWriter) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("xhttp: SSE writer closed")
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(s.w, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// SSEReader reads Server-Sent Events using Client, reconnecting when the
+// connection is lost. Use Client.NewSSEReader to instantiate.
+//
+// For example:
+//
+//     events := c.NewSSEReader(ctx, "jobs/1234/progress")
+//     defer events.Close()
+//
+//     for {
+//         ev, err := events.Next()
+//         if err != nil {
+//             return err // io.EOF when the server replied with 204 No Content
+//         }
+//         fmt.Println(ev.Event, ev.Data)
+//     }
+type SSEReader struct {
+	// LastEventID is the ID of the last event received. It is sent using
+	// the Last-Event-ID header when reconnecting, and can be set before
+	// the first call to Next to resume a stream.
+	LastEventID string
+
+	// RetryDelay is how long to wait before reconnecting. The server can
+	// change it using the retry field. Defaults to 3 seconds.
+	RetryDelay time.Duration
+
+	client *Client
+	ctx    context.Context
+	path   string
+
+	body io.ReadCloser
+	rd   *bufio.Reader
+}
+
+// NewSSEReader returns a new SSEReader reading events from path, which is
+// resolved like with NewRequest. Note that the timeout of c also applies
+// to reading the stream; the reader reconnects when it expires.
+func (c *Client) NewSSEReader(ctx context.Context, path string) *SSEReader {
+	return &SSEReader{
+		RetryDelay: defaultSSERetryDelay,
+		client:     c,
+		ctx:        ctx,
+		path:       path,
+	}
+}
+
+// Next returns the next event, blocking until it is received. When the
+// connection fails or is lost, Next reconnects after RetryDelay.
+// It returns io.EOF when the server replied with HTTP status 204 No
+// Content, which tells clients to stop reconnecting. Other responses
+// which are not 200 OK result in a *StatusError, and when the context is
+// done, its error is returned.
+func (r *SSEReader) Next() (SSEEvent, error) {
+	for {
+		if r.body == nil {
+			if retry, err := r.connect(); err != nil {
+				if !retry || r.ctx.Err() != nil {
+					return SSEEvent{}, err
+				}
+				if err := r.wait(); err != nil {
+					return SSEEvent{}, err
+				}
+				continue
+			}
+		}
+
+		ev, err := r.readEvent()
+		if err == nil {
+			return ev, nil
+		}
+
+		_ = r.Close()
+		if r.ctx.Err() != nil {
+			return SSEEvent{}, r.ctx.Err()
+		}
+		if err := r.wait(); err != nil {
+			return SSEEvent{}, err
+		}
+	}
+}
+
+// Close closes the current connection. Calling Next reconnects.
+func (r *SSEReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	r.rd = nil
+	return err
+}
+
+// connect makes the request for the event stream. When it fails, it
+// returns whether connecting can be retried.
+func (r *SSEReader) connect() (bool, error) {
+	req := r.client.NewRequest(r.ctx, http.MethodGet, r.path).
+		Header(HeaderAccept, ContentTypeSSE).
+		Header("Cache-Control", "no-cache")
+	if r.LastEventID != "" {
+		req.Header("Last-Event-ID", r.LastEventID)
+	}
+
+	httpReq, err := req.HTTPRequest()
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return true, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		_ = resp.Body.Close()
+		return false, io.EOF
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStatusErrorBody))
+		_ = resp.Body.Close()
+		return false, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       body,
+		}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get(HeaderContentType)); mediaType != ContentTypeSSE {
+		_ = resp.Body.Close()
+		return false, fmt.Errorf("xhttp: unexpected content type %q for event stream", mediaType)
+	}
+
+	r.body = resp.Body
+	r.rd = bufio.NewReader(resp.Body)
+	return false, nil
+}
+
+// wait waits RetryDelay, or until the context is done.
+func (r *SSEReader) wait() error {
+	d := r.RetryDelay
+	if d <= 0 {
+		d = defaultSSERetryDelay
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// readEvent reads lines until an event is complete. Incomplete events,
+// including their ID, are discarded when the connection is lost.
+func (r *SSEReader) readEvent() (SSEEvent, error) {
+	var ev SSEEvent
+	var data strings.Builder
+	hasData := false
+	id := r.LastEventID
+
+	for {
+		line, err := r.rd.ReadString('\n')
+		if err != nil {
+			return SSEEvent{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			r.LastEventID = id
+			if !hasData {
+				ev = SSEEvent{}
+				continue
+			}
+			ev.ID = id
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+			return ev, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data.WriteString(value + "\n")
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				id = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+				r.RetryDelay = ev.Retry
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestSSEWriter(t *testing.T) {
+	t.Run("wire format", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		sse, err := NewSSEWriter(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		xt.OK(t, err)
+
+		xt.OK(t, sse.Send(SSEEvent{ID: "1", Event: "progress", Data: "line1\nline2", Retry: 2 * time.Second}))
+		xt.OK(t, sse.SendJSON("done", map[string]int{"percent": 100}))
+		xt.OK(t, sse.Comment("ping"))
+		xt.KO(t, sse.Send(SSEEvent{ID: "1\n2"}))
+		sse.Close()
+		xt.KO(t, sse.Send(SSEEvent{Data: "closed"}))
+
+		xt.Eq(t, http.StatusOK, rec.Code)
+		xt.Eq(t, ContentTypeSSE, rec.Header().Get(HeaderContentType))
+		xt.Eq(t, "no-cache", rec.Header().Get("Cache-Control"))
+		xt.Assert(t, rec.Flushed)
+		exp := "id: 1\nevent: progress\nretry: 2000\ndata: line1\ndata: line2\n\n" +
+			"event: done\ndata: {\"percent\":100}\n\n" +
+			": ping\n\n"
+		xt.Eq(t, exp, rec.Body.String())
+	})
+
+	t.Run("heartbeat stops when client disconnects", func(t *testing.T) {
+		stopped := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sse, err := NewSSEWriter(w, r)
+			if err != nil {
+				return
+			}
+			defer close(stopped)
+			defer sse.Close()
+			sse.Heartbeat(5 * time.Millisecond)
+			<-sse.Done()
+		}))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		xt.OK(t, err)
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		xt.OK(t, err)
+		xt.Eq(t, ": heartbeat\n", line)
+		_ = resp.Body.Close()
+
+		select {
+		case <-stopped:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected handler to return after client disconnected")
+		}
+	})
+}
+
+func TestSSEReader(t *testing.T) {
+	t.Run("reconnects with Last-Event-ID", func(t *testing.T) {
+		var mu sync.Mutex
+		var lastIDs []string
+		var count int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+			mu.Unlock()
+
+			n := atomic.AddInt32(&count, 1)
+			if n > 2 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			sse, err := NewSSEWriter(w, r)
+			if err != nil {
+				return
+			}
+			defer sse.Close()
+
+			switch n {
+			case 1:
+				_ = sse.Send(SSEEvent{Retry: time.Millisecond, Data: ""})
+				_ = sse.Send(SSEEvent{ID: "1", Event: "progress", Data: "10"})
+				_, _ = io.WriteString(w, "id: 2\ndata: incomplete") // lost connection
+			case 2:
+				_ = sse.Comment("resumed")
+				_ = sse.Send(SSEEvent{ID: "2", Data: "a\nb"})
+			}
+		}))
+		defer srv.Close()
+
+		events := NewClient(srv.URL).NewSSEReader(context.Background(), "events")
+		defer func() { _ = events.Close() }()
+
+		ev, err := events.Next()
+		xt.OK(t, err)
+		xt.Eq(t, SSEEvent{Event: "message", Retry: time.Millisecond}, ev)
+
+		ev, err = events.Next()
+		xt.OK(t, err)
+		xt.Eq(t, SSEEvent{ID: "1", Event: "progress", Data: "10"}, ev)
+		xt.Eq(t, time.Millisecond, events.RetryDelay)
+
+		ev, err = events.Next()
+		xt.OK(t, err)
+		xt.Eq(t, SSEEvent{ID: "2", Event: "message", Data: "a\nb"}, ev)
+
+		_, err = events.Next()
+		xt.Eq(t, io.EOF, err)
+		mu.Lock()
+		defer mu.Unlock()
+		xt.Eq(t, []string{"", "1", "2"}, lastIDs)
+	})
+
+	t.Run("not an event stream", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = WriteJSON(w, http.StatusOK, "hello")
+		}))
+		defer srv.Close()
+
+		_, err := NewClient(srv.URL).NewSSEReader(context.Background(), "").Next()
+		xt.KO(t, err)
+		xt.Assert(t, strings.Contains(err.Error(), "unexpected content type"), err.Error())
+	})
+
+	t.Run("status error", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+
+		_, err := NewClient(srv.URL).NewSSEReader(context.Background(), "").Next()
+		xt.KO(t, err)
+		errStatus, ok := err.(*StatusError)
+		xt.Assert(t, ok)
+		xt.Eq(t, http.StatusNotFound, errStatus.StatusCode)
+	})
+
+	t.Run("context done while reconnecting", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		url := srv.URL
+		srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := NewClient(url).NewSSEReader(ctx, "").Next()
+		xt.Eq(t, context.DeadlineExceeded, err)
+	})
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReHashedAsset matches file names containing a content hash, for example
+// `app.3f2a9c1b.js` or `chunk-5d41402abc.css`. These are served as
+// immutable by StaticHandler.
+var ReHashedAsset = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[0-9A-Za-z]+$`)
+
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// StaticOptions configures the handler returned by StaticHandler.
+type StaticOptions struct {
+	// Prefix is stripped from the path of the request before looking up
+	// the file. For example, `/static/` when the handler is registered
+	// using the pattern `^/static/`.
+	Prefix string
+
+	// IndexFile is served for requests of directories. Defaults to
+	// index.html. Directories are never listed.
+	IndexFile string
+
+	// SPAFallback serves the index file of the root when the requested
+	// file does not exist, and the path has no file extension. This
+	// is needed for single-page applications doing their own routing.
+	SPAFallback bool
+
+	// MaxAge is used in the Cache-Control header of files which are not
+	// immutable. When zero, clients must always revalidate.
+	MaxAge time.Duration
+
+	// Immutable matches the names of files which can be cached forever
+	// because their name changes with their content. Defaults to
+	// ReHashedAsset.
+	Immutable *regexp.Regexp
+}
+
+// precompressed lists the encodings of which precompressed siblings are
+// looked up, in order of preference.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{encoding: "br", ext: ".br"},
+	{encoding: "gzip", ext: ".gz"},
+}
+
+type staticHandler struct {
+	fsys  fs.FS
+	opts  StaticOptions
+	etags sync.Map // name, size and modification time mapped to ETag
+}
+
+// StaticHandler returns a handler serving the files of fsys, which can,
+// for example, be an embed.FS or the result of os.DirFS. Only the methods
+// GET and HEAD are allowed.
+//
+// Responses have an ETag and, when available, Last-Modified header so
+// that conditional requests are answered with 304 (not modified). When the
+// client accepts it, a precompressed sibling of the file with extension
+// `.br` or `.gz` is served instead. Files of which the name contains a
+// content hash (see StaticOptions.Immutable) are cached forever.
+//
+// For example:
+//
+//     //go:embed assets
+//     var assets embed.FS
+//
+//     mux.Handle("^/static/", xhttp.StaticHandler(assets, xhttp.StaticOptions{
+//         Prefix: "/static/",
+//     }), xhttp.MethodGet, xhttp.MethodHead)
+func StaticHandler(fsys fs.FS, opts StaticOptions) http.Handler {
+	if opts.IndexFile == "" {
+		opts.IndexFile = "index.html"
+	}
+	if opts.Immutable == nil {
+		opts.Immutable = ReHashedAsset
+	}
+
+	return &staticHandler{
+		fsys: fsys,
+		opts: opts,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set(HeaderAllow, joinMethods([]Method{MethodGet, MethodHead}))
+		MethodNotAllowed(w, r)
+		return
+	}
+
+	reqName, ok := h.fileName(r.URL.Path)
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+
+	name := reqName
+	fi, err := fs.Stat(h.fsys, name)
+	if err == nil && fi.IsDir() {
+		name = path.Join(name, h.opts.IndexFile)
+		fi, err = fs.Stat(h.fsys, name)
+	}
+
+	if err != nil || fi.IsDir() {
+		if !(h.opts.SPAFallback && path.Ext(reqName) == "") {
+			NotFound(w, r)
+			return
+		}
+
+		name = h.opts.IndexFile
+		if fi, err = fs.Stat(h.fsys, name); err != nil {
+			NotFound(w, r)
+			return
+		}
+	}
+
+	if err := h.serveFile(w, r, name, fi); err != nil {
+		InternalError(w, r)
+	}
+}
+
+// fileName returns the name of the file within the file system for the
+// request path p. Returns false when p does not have the prefix.
+func (h *staticHandler) fileName(p string) (string, bool) {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+
+	prefix := h.opts.Prefix
+	if prefix != "" {
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		if !strings.HasPrefix(p+"/", strings.TrimSuffix(prefix, "/")+"/") {
+			return "", false
+		}
+		p = "/" + strings.TrimPrefix(p, strings.TrimSuffix(prefix, "/"))
+	}
+
+	name := strings.TrimPrefix(path.Clean(p), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+// serveFile serves name, or its precompressed sibling when accepted by
+// the client.
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, fi fs.FileInfo) error {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	serveName := name
+	encoding := ""
+
+	addVary(w.Header(), "Accept-Encoding")
+
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, pc := range precompressed {
+		if !acceptsEncoding(accepted, pc.encoding) {
+			continue
+		}
+		if cfi, err := fs.Stat(h.fsys, name+pc.ext); err == nil && !cfi.IsDir() {
+			serveName = name + pc.ext
+			encoding = pc.encoding
+			fi = cfi
+			break
+		}
+	}
+
+	content, err := h.open(serveName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = content.Close() }()
+
+	etag, err := h.etag(serveName, fi, content)
+	if err != nil {
+		return err
+	}
+
+	hdr := w.Header()
+	hdr.Set("ETag", etag)
+	hdr.Set("Cache-Control", h.cacheControl(name))
+	if encoding != "" {
+		hdr.Set("Content-Encoding", encoding)
+		if contentType == "" {
+			contentType = ContentTypeBinary
+		}
+	}
+	if contentType != "" {
+		hdr.Set(HeaderContentType, contentType)
+	}
+
+	http.ServeContent(w, r, name, fi.ModTime(), content)
+	return nil
+}
+
+// cacheControl returns the value of the Cache-Control header for the file
+// name.
+func (h *staticHandler) cacheControl(name string) string {
+	switch {
+	case path.Base(name) == h.opts.IndexFile:
+		return "no-cache"
+	case h.opts.Immutable.MatchString(path.Base(name)):
+		return "public, max-age=" + strconv.Itoa(int(immutableMaxAge.Seconds())) + ", immutable"
+	case h.opts.MaxAge > 0:
+		return "public, max-age=" + strconv.Itoa(int(h.opts.MaxAge.Seconds()))
+	}
+	return "no-cache"
+}
+
+// seekCloser is an io.ReadSeeker which needs to be closed.
+type seekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// open opens name returning it as a seekCloser. Files which can not
+// seek are read into memory.
+func (h *staticHandler) open(name string) (seekCloser, error) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc, ok := f.(seekCloser); ok {
+		return sc, nil
+	}
+
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// etag returns the ETag of the file name using a hash of its content. The
+// ETag is cached until the size or modification time of the file changes.
+func (h *staticHandler) etag(name string, fi fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := name + "\x00" + strconv.FormatInt(fi.Size(), 10) + "\x00" + fi.ModTime().String()
+	if v, have := h.etags.Load(key); have {
+		return v.(string), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.etags.Store(key, etag)
+	return etag, nil
+}
+
+// acceptsEncoding returns whether the value of the Accept-Encoding header
+// accepts encoding, taking quality values into account.
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), encoding) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
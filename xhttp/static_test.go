@@ -0,0 +1,112 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestStaticHandler(t *testing.T) {
+	modTime := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":             {Data: []byte("<html>app</html>"), ModTime: modTime},
+		"css/site.css":           {Data: []byte("body {}"), ModTime: modTime},
+		"js/app.3f2a9c1b.js":     {Data: []byte("console.log('app')"), ModTime: modTime},
+		"js/app.3f2a9c1b.js.gz":  {Data: []byte("gzipped"), ModTime: modTime},
+		"js/app.3f2a9c1b.js.br":  {Data: []byte("brotli"), ModTime: modTime},
+		"docs/readme.txt":        {Data: []byte("read me"), ModTime: modTime},
+		"docs/nested/index.html": {Data: []byte("nested"), ModTime: modTime},
+	}
+
+	h := StaticHandler(fsys, StaticOptions{
+		Prefix:      "/static/",
+		SPAFallback: true,
+		MaxAge:      time.Hour,
+	})
+
+	get := func(p string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("serve file", func(t *testing.T) {
+		rr := get("/static/css/site.css", nil)
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "body {}", rr.Body.String())
+		xt.Eq(t, "text/css; charset=utf-8", rr.Header().Get(HeaderContentType))
+		xt.Eq(t, "public, max-age=3600", rr.Header().Get("Cache-Control"))
+		xt.Eq(t, modTime.Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+		xt.Assert(t, rr.Header().Get("ETag") != "")
+	})
+
+	t.Run("conditional requests", func(t *testing.T) {
+		etag := get("/static/css/site.css", nil).Header().Get("ETag")
+
+		rr := get("/static/css/site.css", map[string]string{"If-None-Match": etag})
+		xt.Eq(t, http.StatusNotModified, rr.Code)
+
+		rr = get("/static/css/site.css", map[string]string{
+			"If-Modified-Since": modTime.Add(time.Minute).Format(http.TimeFormat),
+		})
+		xt.Eq(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("hashed assets are immutable", func(t *testing.T) {
+		rr := get("/static/js/app.3f2a9c1b.js", nil)
+		xt.Eq(t, "console.log('app')", rr.Body.String())
+		xt.Eq(t, "public, max-age=31536000, immutable", rr.Header().Get("Cache-Control"))
+	})
+
+	t.Run("precompressed siblings", func(t *testing.T) {
+		rr := get("/static/js/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip, br"})
+		xt.Eq(t, "brotli", rr.Body.String())
+		xt.Eq(t, "br", rr.Header().Get("Content-Encoding"))
+		xt.Eq(t, "text/javascript; charset=utf-8", rr.Header().Get(HeaderContentType))
+		xt.Eq(t, "Accept-Encoding", rr.Header().Get("Vary"))
+
+		rr = get("/static/js/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"})
+		xt.Eq(t, "gzipped", rr.Body.String())
+		xt.Eq(t, "gzip", rr.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("directories are not listed", func(t *testing.T) {
+		xt.Eq(t, "<html>app</html>", get("/static/docs/", nil).Body.String(), "expected SPA fallback")
+		xt.Eq(t, "nested", get("/static/docs/nested/", nil).Body.String())
+
+		rr := httptest.NewRecorder()
+		StaticHandler(fsys, StaticOptions{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+		xt.Eq(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("SPA fallback", func(t *testing.T) {
+		rr := get("/static/account/settings", nil)
+		xt.Eq(t, http.StatusOK, rr.Code)
+		xt.Eq(t, "<html>app</html>", rr.Body.String())
+		xt.Eq(t, "no-cache", rr.Header().Get("Cache-Control"))
+
+		xt.Eq(t, http.StatusNotFound, get("/static/missing.css", nil).Code)
+	})
+
+	t.Run("paths outside file system", func(t *testing.T) {
+		xt.Eq(t, http.StatusNotFound, get("/other/index.html", nil).Code)
+		xt.Eq(t, "<html>app</html>", get("/static/../../index.html", nil).Body.String())
+	})
+
+	t.Run("only GET and HEAD", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/static/css/site.css", nil))
+		xt.Eq(t, http.StatusMethodNotAllowed, rr.Code)
+		xt.Eq(t, "GET, HEAD", rr.Header().Get(HeaderAllow))
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xlog"
+)
+
+// RedactQueryParams lists the names of query parameters of which the value
+// is replaced with `REDACTED` when URLs are logged by Client, or recorded
+// by xhttptest.Recorder. Names are compared case-insensitive.
+var RedactQueryParams = []string{
+	"access_token", "api_key", "apikey", "client_secret", "key",
+	"password", "secret", "signature", "token",
+}
+
+// RequestTrace holds the timing of a single attempt of a request made
+// by Client. Durations of phases which did not happen, for example DNS
+// when the connection was reused, are zero.
+type RequestTrace struct {
+	Request *http.Request
+	Attempt int // starts at 1
+
+	// StatusCode is the HTTP status code of the response, or zero when
+	// the attempt failed with Err.
+	StatusCode int
+	Err        error
+
+	DNS        time.Duration
+	Connect    time.Duration
+	TLS        time.Duration
+	FirstByte  time.Duration // from start until the first response byte
+	Total      time.Duration // from start until the response headers were read
+	ReusedConn bool
+}
+
+// ClientTracer receives a RequestTrace for each attempt of requests made
+// by Client. It can, for example, be used to record metrics. Tracers are
+// called from the goroutine making the request.
+type ClientTracer interface {
+	TraceRequest(trace RequestTrace)
+}
+
+// ClientTracerFunc is an adapter to use an ordinary function as
+// ClientTracer.
+type ClientTracerFunc func(trace RequestTrace)
+
+// TraceRequest calls f(trace).
+func (f ClientTracerFunc) TraceRequest(trace RequestTrace) {
+	f(trace)
+}
+
+// WithRequestLogger is a functional option for xhttp.NewClient logging
+// each request using l. Logged are the method, the URL with secrets
+// redacted (see RedactQueryParams), the HTTP status code, the duration
+// including retries, and the number of attempts.
+func WithRequestLogger(l *xlog.Logger) ClientOption {
+	return func(options *clientOptions) {
+		options.Logger = l
+	}
+}
+
+// WithTracer is a functional option for xhttp.NewClient reporting the
+// timing of each attempt of each request to tracer. The timing is
+// collected using net/http/httptrace.
+func WithTracer(tracer ClientTracer) ClientOption {
+	return func(options *clientOptions) {
+		options.Tracer = tracer
+	}
+}
+
+// attemptTrace collects the timing of an attempt using httptrace.
+type attemptTrace struct {
+	mu    sync.Mutex
+	start time.Time
+	trace RequestTrace
+
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+func newAttemptTrace(req *http.Request, attempt int) *attemptTrace {
+	return &attemptTrace{
+		start: time.Now(),
+		trace: RequestTrace{Request: req, Attempt: attempt},
+	}
+}
+
+// clientTrace returns the httptrace.ClientTrace recording into a.
+func (a *attemptTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			a.mu.Lock()
+			a.trace.ReusedConn = info.Reused
+			a.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			a.mu.Lock()
+			a.dnsStart = time.Now()
+			a.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			a.mu.Lock()
+			a.trace.DNS = time.Since(a.dnsStart)
+			a.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			a.mu.Lock()
+			a.connectStart = time.Now()
+			a.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			a.mu.Lock()
+			a.trace.Connect = time.Since(a.connectStart)
+			a.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			a.mu.Lock()
+			a.tlsStart = time.Now()
+			a.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			a.mu.Lock()
+			a.trace.TLS = time.Since(a.tlsStart)
+			a.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			a.mu.Lock()
+			a.trace.FirstByte = time.Since(a.start)
+			a.mu.Unlock()
+		},
+	}
+}
+
+// done returns the trace of the attempt which resulted in resp or err.
+func (a *attemptTrace) done(resp *http.Response, err error) RequestTrace {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.trace.Total = time.Since(a.start)
+	a.trace.Err = err
+	if resp != nil {
+		a.trace.StatusCode = resp.StatusCode
+	}
+	return a.trace
+}
+
+// logRequest logs the request req using l.
+func logRequest(l *xlog.Logger, req *http.Request, resp *http.Response, err error, attempts int, d time.Duration) {
+	entry := l.WithFields(xlog.Fields{
+		"method":   req.Method,
+		"url":      RedactURL(req.URL),
+		"duration": d,
+		"attempts": attempts,
+	})
+
+	if err != nil {
+		entry.WithError(err).Error("HTTP request failed")
+		return
+	}
+
+	entry.WithField("status", resp.StatusCode).Info("HTTP request")
+}
+
+// RedactURL returns u as string without password, and with the values of
+// query parameters listed in RedactQueryParams replaced.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	c := *u
+	if c.RawQuery != "" {
+		q := c.Query()
+		for name := range q {
+			for _, r := range RedactQueryParams {
+				if strings.EqualFold(name, r) {
+					q[name] = []string{"REDACTED"}
+				}
+			}
+		}
+		c.RawQuery = q.Encode()
+	}
+
+	return c.Redacted()
+}
@@ -4,6 +4,10 @@ package xhttp
 
 import (
 	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xlog"
 )
 
 const (
@@ -15,16 +19,113 @@ type transport struct {
 	bearer                string
 	tlsInsecureSkipVerify bool
 	contentType           string
+	retry                 *RetryPolicy
+	auth                  Authenticator
+	err                   error // returned by RoundTrip when set
+	logger                *xlog.Logger
+	tracer                ClientTracer
+	base                  http.RoundTripper // used instead of trp when set
+	breaker               *circuitBreaker
 }
 
-// RoundTrip implements a RoundTripper over HTTP.
+// RoundTrip implements a RoundTripper over HTTP. The request req is not
+// modified; a copy is sent.
 //
 // When t has a authorization bearer, it will set the HTTP Authorization
-// header.
+// header, unless req already has it. When req has a body, but no
+// Content-Type header, the content type of t is used. When t has a retry
+// policy, failed requests are retried according to it. When t has an
+// Authenticator, it is used for each attempt. When t has a circuit
+// breaker, attempts to hosts of which the circuit is open fail with
+// ErrCircuitOpen.
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if t.bearer != "" {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	req = req.Clone(req.Context())
+	if t.bearer != "" && req.Header.Get(HeaderAuthorization) == "" {
 		req.Header.Set(HeaderAuthorization, "Bearer "+t.bearer)
 	}
-	req.Header.Set(HeaderContentType, t.contentType)
+	if hasBody(req) && req.Header.Get(HeaderContentType) == "" && t.contentType != "" {
+		req.Header.Set(HeaderContentType, t.contentType)
+	}
+
+	start := time.Now()
+	attempts := 0
+	send := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return t.send(req, attempts)
+	})
+
+	var resp *http.Response
+	var err error
+	if t.retry != nil {
+		resp, err = t.retry.roundTripRetry(send, req)
+	} else {
+		resp, err = send(req)
+	}
+
+	if t.logger != nil {
+		logRequest(t.logger, req, resp, err, attempts, time.Since(start))
+	}
+
+	return resp, err
+}
+
+// send authenticates and sends a single attempt of req. When t has a
+// tracer, the timing of the attempt is reported to it.
+func (t *transport) send(req *http.Request, attempt int) (*http.Response, error) {
+	orig := req
+	if t.auth != nil || t.tracer != nil {
+		req = req.Clone(req.Context())
+	}
+
+	if t.auth != nil {
+		if err := t.auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.tracer == nil {
+		return t.roundTripBase(req)
+	}
+
+	at := newAttemptTrace(orig, attempt)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), at.clientTrace()))
+	resp, err := t.roundTripBase(req)
+	t.tracer.TraceRequest(at.done(resp, err))
+	return resp, err
+}
+
+// roundTripBase sends req using the base http.RoundTripper, or when not
+// set, the HTTP transport of t. When t has a circuit breaker, it is
+// consulted first.
+func (t *transport) roundTripBase(req *http.Request) (*http.Response, error) {
+	if t.breaker != nil {
+		return t.breaker.roundTrip(roundTripperFunc(t.roundTripHost), req)
+	}
+	return t.roundTripHost(req)
+}
+
+// roundTripHost sends req to its host.
+func (t *transport) roundTripHost(req *http.Request) (*http.Response, error) {
+	if t.base != nil {
+		return t.base.RoundTrip(req)
+	}
 	return t.trp.RoundTrip(req)
 }
+
+// roundTripperFunc is an adapter to use an ordinary function as
+// http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// hasBody returns whether req has a body.
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Params holds the values used to build the URL of a named route. The keys
+// are the names of the captures within the route's pattern.
+type Params map[string]interface{}
+
+var (
+	// ErrRouteNotFound is returned when no route was registered using a
+	// particular name.
+	ErrRouteNotFound = errors.New("route not found")
+
+	// ErrRouteNotReversible is returned when the pattern of a route contains
+	// regular expression syntax other than captures, and the URL can
+	// therefore not be built.
+	ErrRouteNotReversible = errors.New("route not reversible")
+)
+
+// reCaptureValues holds for each capture converter a regular expression
+// which can be used to validate values.
+var reCaptureValues = func() map[string]*regexp.Regexp {
+	res := map[string]*regexp.Regexp{}
+	for conv, reg := range captureRegs {
+		res[conv] = regexp.MustCompile("^" + fmt.Sprintf(reg, "v") + "$")
+	}
+	return res
+}()
+
+// URL returns the path of the route registered using name, replacing the
+// captures within its pattern with the values found in params. Each
+// value is checked against the converter of its capture.
+// Routes of mounted ServeReMux are also looked up, in which case the
+// values for captures of the mount prefix are also taken from params.
+//
+// For example, using the route registered as follows:
+//
+//     mux.HandleNamed("person", "^/person/<int:id>$", PersonHandler())
+//
+// the URL for the person with ID 42 is built like this:
+//
+//     u, err := mux.URL("person", xhttp.Params{"id": 42}) // u is /person/42
+//
+// Returns ErrRouteNotFound when name is not registered, and
+// ErrRouteNotReversible when the pattern contains regular expressions
+// other than captures.
+func (s *ServeReMux) URL(name string, params Params) (string, error) {
+	pattern, ok := s.namedPattern(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrRouteNotFound, name)
+	}
+
+	u, err := reversePattern(pattern, params)
+	if err != nil {
+		return "", fmt.Errorf("failed building URL for route `%s` (%w)", name, err)
+	}
+	return u, nil
+}
+
+// MustURL is like URL but panics when the URL could not be built. It is
+// mostly useful within templates.
+func (s *ServeReMux) MustURL(name string, params Params) string {
+	u, err := s.URL(name, params)
+	if err != nil {
+		panic("xhttp: " + err.Error())
+	}
+	return u
+}
+
+// namedPattern returns the pattern registered using name. When found in
+// a mounted ServeReMux, the returned pattern includes the mount prefix.
+func (s *ServeReMux) namedPattern(name string) (string, bool) {
+	if p, have := s.names[name]; have {
+		return p, true
+	}
+
+	for _, v := range s.handlers.Values() {
+		h, ok := v.(*reHandler)
+		if !ok || h.mounted == nil {
+			continue
+		}
+		if p, ok := h.mounted.namedPattern(name); ok {
+			return joinPatterns(h.pattern, p), true
+		}
+	}
+
+	return "", false
+}
+
+// reversePattern builds a path from pattern replacing the captures with
+// the values found in params.
+func reversePattern(pattern string, params Params) (string, error) {
+	used := map[string]bool{}
+
+	res, err := buildPath(pattern, func(name, conv string) (string, error) {
+		v, have := params[name]
+		if !have {
+			return "", fmt.Errorf("missing value for capture `%s`", name)
+		}
+		value := fmt.Sprint(v)
+		if !reCaptureValues[conv].MatchString(value) {
+			return "", fmt.Errorf("value '%s' of capture `%s` is not valid for converter %s",
+				value, name, conv)
+		}
+		used[name] = true
+		return value, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var unknown []string
+	for name := range params {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("unknown captures %s", strings.Join(unknown, ", "))
+	}
+
+	return res, nil
+}
+
+// buildPath builds a path from pattern using replace to get the
+// replacement of each capture. Returns ErrRouteNotReversible when the
+// pattern contains regular expression syntax other than captures.
+func buildPath(pattern string, replace func(name, converter string) (string, error)) (string, error) {
+	p := strings.TrimPrefix(pattern, "^")
+	if strings.HasSuffix(p, "$") && !strings.HasSuffix(p, `\$`) {
+		p = p[:len(p)-1]
+	}
+
+	var b strings.Builder
+	pos := 0
+
+	for _, loc := range reCaptures.FindAllStringSubmatchIndex(p, -1) {
+		lit, err := unescapePattern(p[pos:loc[0]])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(lit)
+
+		conv := defaultCaptureConverter
+		if loc[4] != -1 {
+			conv = p[loc[4]:loc[5]]
+		}
+
+		value, err := replace(p[loc[6]:loc[7]], conv)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		pos = loc[1]
+	}
+
+	lit, err := unescapePattern(p[pos:])
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(lit)
+
+	if b.Len() == 0 {
+		return "/", nil
+	}
+	return b.String(), nil
+}
+
+// unescapePattern returns the literal string of a part of a pattern
+// without captures. Returns ErrRouteNotReversible when s contains regular
+// expression syntax.
+func unescapePattern(s string) (string, error) {
+	var b strings.Builder
+	escaped := false
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			if c < 128 && (c == '_' || ('0' <= c && c <= '9') ||
+				('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')) {
+				return "", fmt.Errorf("%w (escape sequence \\%c)", ErrRouteNotReversible, c)
+			}
+			escaped = false
+		case c == '\\':
+			escaped = true
+			continue
+		case strings.ContainsRune(".+*?()|[]{}^$", c):
+			return "", fmt.Errorf("%w (contains %c)", ErrRouteNotReversible, c)
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestServeReMux_URL(t *testing.T) {
+	mux := NewServeReMux()
+	mux.HandleNamed("home", `^/$`, pathEchoHandler{})
+	mux.HandleNamed("person", `^/person/<int:id>$`, pathEchoHandler{})
+	mux.HandleNamed("image", `^/blog/<blogUID>/images/<int:imageID>/thumbnail\.png$`, pathEchoHandler{})
+	mux.HandleNamed("regex", `^/fo(o|bar)$`, pathEchoHandler{})
+
+	api := NewServeReMux()
+	api.HandleNamed("member", `^/members/<int:id>$`, pathEchoHandler{})
+	mux.Mount(`^/org/<orgUID>/api`, api)
+
+	v2 := NewServeReMux()
+	v2.HandleNamed("version", `^/version$`, pathEchoHandler{})
+	mux.Mount(`^/v2/`, v2)
+
+	t.Run("build URLs", func(t *testing.T) {
+		cases := map[string]struct {
+			name   string
+			params Params
+			exp    string
+		}{
+			"root":            {name: "home", exp: "/"},
+			"int capture":     {name: "person", params: Params{"id": 42}, exp: "/person/42"},
+			"int as string":   {name: "person", params: Params{"id": "42"}, exp: "/person/42"},
+			"escaped literal": {name: "image", params: Params{"blogUID": "Y4sSn8f", "imageID": 7}, exp: "/blog/Y4sSn8f/images/7/thumbnail.png"},
+			"mounted route":   {name: "member", params: Params{"orgUID": "acme", "id": 3}, exp: "/org/acme/api/members/3"},
+			"prefix with /":   {name: "version", exp: "/v2/version"},
+		}
+
+		for n, cs := range cases {
+			t.Run(n, func(t *testing.T) {
+				u, err := mux.URL(cs.name, cs.params)
+				xt.OK(t, err)
+				xt.Eq(t, cs.exp, u)
+			})
+		}
+	})
+
+	t.Run("route not found", func(t *testing.T) {
+		_, err := mux.URL("nope", nil)
+		xt.KO(t, err)
+		xt.Assert(t, errors.Is(err, ErrRouteNotFound))
+	})
+
+	t.Run("route not reversible", func(t *testing.T) {
+		_, err := mux.URL("regex", nil)
+		xt.KO(t, err)
+		xt.Assert(t, errors.Is(err, ErrRouteNotReversible))
+	})
+
+	t.Run("value not valid for converter", func(t *testing.T) {
+		_, err := mux.URL("person", Params{"id": "abc"})
+		xt.KO(t, err)
+		xt.Match(t, `value 'abc' of capture .id. is not valid for converter int`, err.Error())
+	})
+
+	t.Run("missing and unknown values", func(t *testing.T) {
+		_, err := mux.URL("person", nil)
+		xt.KO(t, err)
+		xt.Match(t, `missing value for capture .id.`, err.Error())
+
+		_, err = mux.URL("person", Params{"id": 1, "name": "x"})
+		xt.KO(t, err)
+		xt.Match(t, `unknown captures name`, err.Error())
+	})
+
+	t.Run("name must be unique", func(t *testing.T) {
+		xt.Panics(t, func() {
+			mux.HandleNamed("home", `^/home$`, pathEchoHandler{})
+		})
+	})
+
+	t.Run("MustURL panics", func(t *testing.T) {
+		xt.Eq(t, "/person/1", mux.MustURL("person", Params{"id": 1}))
+		xt.Panics(t, func() {
+			mux.MustURL("nope", nil)
+		})
+	})
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/geertjanvdk/xkit/xid"
+	"github.com/geertjanvdk/xkit/xiso"
+	"github.com/geertjanvdk/xkit/xnet"
+	"github.com/geertjanvdk/xkit/xutil"
+)
+
+// FieldError describes why the value of a field is not valid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError holds the errors of all fields which are not valid.
+type ValidationError []FieldError
+
+// Error returns the field errors as a single string.
+func (ve ValidationError) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed (" + strings.Join(msgs, "; ") + ")"
+}
+
+// Validate checks the fields of the struct v using the rules found in the
+// `validate` struct tag. Rules are separated by comma. Field names are
+// reported using their JSON name. Nested structs, and slices of structs,
+// are validated as well. Fields of embedded structs are reported without
+// prefix, as encoding/json flattens them.
+//
+// The following rules are supported:
+//
+// * required: value must not be the zero value
+//
+// * email: string must be an email address (see xnet.IsEmailAddress)
+//
+// * uuid: string must be a UUID (see xid.UUIDIsValid)
+//
+// * currency: string must be an ISO 4217 currency code
+//
+// * country: string must be an ISO 3166 Alpha-2 or Alpha-3 country code
+//
+// * min=n, max=n: length of strings, slices and maps, or value of numbers
+//
+// * len=n: length of strings, slices and maps, or value of numbers
+//
+// * omitempty: no other rule is checked when the value is the zero value
+//
+// The rules email, uuid, currency and country are not checked when the
+// value is the zero value; use required to reject it. The rules min, max
+// and len are checked, unless omitempty is used. Rules are not checked for
+// nil pointers. Returns ValidationError when one or more fields are not valid.
+// Panics when a rule is not supported, as this is a programming error.
+func Validate(v interface{}) error {
+	var errs ValidationError
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateValue(rv reflect.Value, prefix string, errs *ValidationError) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			validateValue(rv.Index(i), fmt.Sprintf("%s[%d]", prefix, i), errs)
+		}
+		return
+	default:
+		return
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.Anonymous && jsonTagName(sf) == "" && isStructType(sf.Type) {
+			// like encoding/json, fields of embedded structs are flattened
+			validateValue(rv.Field(i), prefix, errs)
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue // not exported
+		}
+
+		name := jsonFieldName(sf)
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fv := rv.Field(i)
+		if tag, have := sf.Tag.Lookup("validate"); have {
+			if fe := validateField(fv, name, tag); fe != nil {
+				*errs = append(*errs, *fe)
+				continue
+			}
+		}
+
+		validateValue(fv, name, errs)
+	}
+}
+
+// validationRules are the rules supported by Validate.
+var validationRules = map[string]bool{
+	"required": true, "omitempty": true, "email": true, "uuid": true,
+	"currency": true, "country": true, "min": true, "max": true, "len": true,
+}
+
+// validateField checks the value fv of the field name using the rules in
+// tag. The first rule which fails is reported.
+func validateField(fv reflect.Value, name, tag string) *FieldError {
+	rules := strings.Split(tag, ",")
+	for i := range rules {
+		rules[i] = strings.TrimSpace(rules[i])
+	}
+	omitEmpty := xutil.HasString(rules, "omitempty")
+
+	for _, rule := range rules {
+		if rule == "" || rule == "omitempty" {
+			continue
+		}
+
+		ruleName, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i != -1 {
+			ruleName, arg = rule[:i], rule[i+1:]
+		}
+
+		// checked before values are, so mistakes show even for empty fields
+		if !validationRules[ruleName] {
+			panic("xhttp: unsupported validation rule `" + rule + "` for field " + name)
+		}
+
+		if rule == "required" {
+			if fv.IsZero() {
+				return &FieldError{Field: name, Rule: rule, Message: "is required"}
+			}
+			continue
+		}
+
+		if (omitEmpty && fv.IsZero()) || (fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			continue
+		}
+
+		if fv.IsZero() && ruleName != "min" && ruleName != "max" && ruleName != "len" {
+			continue
+		}
+
+		var msg string
+		switch ruleName {
+		case "email":
+			if !xnet.IsEmailAddress(stringValue(fv)) {
+				msg = "must be an email address"
+			}
+		case "uuid":
+			if !xid.UUIDIsValid(stringValue(fv)) {
+				msg = "must be a UUID"
+			}
+		case "currency":
+			if _, err := xiso.Currency(stringValue(fv)); err != nil {
+				msg = "must be an ISO 4217 currency code"
+			}
+		case "country":
+			s := stringValue(fv)
+			if xiso.CountryAlpha2(s).IsEmpty() && xiso.CountryAlpha3(s).IsEmpty() {
+				msg = "must be an ISO 3166 country code"
+			}
+		case "min", "max", "len":
+			msg = validateRange(fv, ruleName, arg)
+		default:
+			panic("xhttp: unsupported validation rule `" + rule + "` for field " + name)
+		}
+
+		if msg != "" {
+			return &FieldError{Field: name, Rule: ruleName, Message: msg}
+		}
+	}
+
+	return nil
+}
+
+// validateRange checks value fv using the min, max or len rule with limit
+// arg. Returns the error message when not valid.
+func validateRange(fv reflect.Value, rule, arg string) string {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic("xhttp: invalid argument for validation rule " + rule + "; was " + arg)
+	}
+
+	var n float64
+	what := "must be"
+	for fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		n = float64(fv.Len())
+		what = "length must be"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = fv.Float()
+	default:
+		panic("xhttp: validation rule " + rule + " not supported for " + fv.Kind().String())
+	}
+
+	switch {
+	case rule == "min" && n < limit:
+		return fmt.Sprintf("%s at least %s", what, arg)
+	case rule == "max" && n > limit:
+		return fmt.Sprintf("%s at most %s", what, arg)
+	case rule == "len" && n != limit:
+		return fmt.Sprintf("%s exactly %s", what, arg)
+	}
+	return ""
+}
+
+// stringValue returns the string of fv, dereferencing pointers.
+func stringValue(fv reflect.Value) string {
+	for fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+	if fv.Kind() != reflect.String {
+		return fmt.Sprint(fv.Interface())
+	}
+	return fv.String()
+}
+
+// jsonFieldName returns the name of the field as it is encoded in JSON.
+func jsonFieldName(sf reflect.StructField) string {
+	if name := jsonTagName(sf); name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+// jsonTagName returns the name found in the json struct tag of sf, or an
+// empty string.
+func jsonTagName(sf reflect.StructField) string {
+	return strings.Split(sf.Tag.Get("json"), ",")[0]
+}
+
+// isStructType returns whether t is a struct, or a pointer to a struct.
+func isStructType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestValidate(t *testing.T) {
+	type address struct {
+		Country string `json:"country" validate:"required,country"`
+	}
+
+	type audit struct {
+		CreatedBy string `json:"createdBy" validate:"min=3"`
+	}
+
+	type person struct {
+		audit
+		ID        string    `json:"id" validate:"uuid"`
+		Age       int       `json:"age" validate:"omitempty,min=18,max=130"`
+		Tags      []string  `json:"tags" validate:"max=2"`
+		Address   *address  `json:"address"`
+		Addresses []address `json:"addresses"`
+		internal  string    `validate:"required"`
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		xt.OK(t, Validate(&person{
+			audit:     audit{CreatedBy: "admin"},
+			ID:        "7e4e4b59-7a36-4a4c-9c1c-7f0f8e2a1b3d",
+			Age:       42,
+			Address:   &address{Country: "BE"},
+			Addresses: []address{{Country: "BEL"}},
+		}))
+	})
+
+	t.Run("omitempty skips zero values", func(t *testing.T) {
+		xt.OK(t, Validate(person{audit: audit{CreatedBy: "admin"}}))
+	})
+
+	t.Run("zero values are checked by min, max and len", func(t *testing.T) {
+		err := Validate(struct {
+			Count   int     `json:"count" validate:"min=1"`
+			Name    string  `json:"name" validate:"min=3"`
+			Code    string  `json:"code" validate:"len=2"`
+			Email   string  `json:"email" validate:"email"`
+			Comment *string `json:"comment" validate:"min=1"`
+		}{})
+
+		var ve ValidationError
+		xt.Assert(t, errors.As(err, &ve))
+		xt.Eq(t, ValidationError{
+			{Field: "count", Rule: "min", Message: "must be at least 1"},
+			{Field: "name", Rule: "min", Message: "length must be at least 3"},
+			{Field: "code", Rule: "len", Message: "length must be exactly 2"},
+		}, ve)
+	})
+
+	t.Run("field errors", func(t *testing.T) {
+		err := Validate(&person{
+			audit:     audit{CreatedBy: "x"},
+			ID:        "not-a-uuid",
+			Age:       12,
+			Tags:      []string{"a", "b", "c"},
+			Address:   &address{},
+			Addresses: []address{{Country: "BE"}, {Country: "XX"}},
+		})
+		xt.KO(t, err)
+
+		var ve ValidationError
+		xt.Assert(t, errors.As(err, &ve))
+		xt.Eq(t, ValidationError{
+			{Field: "createdBy", Rule: "min", Message: "length must be at least 3"},
+			{Field: "id", Rule: "uuid", Message: "must be a UUID"},
+			{Field: "age", Rule: "min", Message: "must be at least 18"},
+			{Field: "tags", Rule: "max", Message: "length must be at most 2"},
+			{Field: "address.country", Rule: "required", Message: "is required"},
+			{Field: "addresses[1].country", Rule: "country", Message: "must be an ISO 3166 country code"},
+		}, ve)
+	})
+
+	t.Run("unsupported rule panics", func(t *testing.T) {
+		xt.Panics(t, func() {
+			_ = Validate(struct {
+				Name string `validate:"shiny"`
+			}{Name: "x"})
+		})
+
+		// also when the field is empty
+		xt.Panics(t, func() {
+			_ = Validate(struct {
+				Email string `validate:"emial"`
+			}{})
+		})
+	})
+}
@@ -0,0 +1,665 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geertjanvdk/xkit/xutil"
+)
+
+const (
+	websocketGUID                  = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWebSocketMaxMessageSize = 1 << 20
+	maxControlPayload              = 125
+)
+
+// WebSocketMessageType is the type of WebSocket data messages.
+type WebSocketMessageType int
+
+const (
+	// WebSocketText is a message holding UTF-8 encoded text.
+	WebSocketText WebSocketMessageType = 1
+	// WebSocketBinary is a message holding binary data.
+	WebSocketBinary WebSocketMessageType = 2
+)
+
+// WebSocket frame opcodes.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// WebSocket close codes as defined by RFC 6455.
+const (
+	WebSocketCloseNormal          = 1000
+	WebSocketCloseGoingAway       = 1001
+	WebSocketCloseProtocolError   = 1002
+	WebSocketCloseUnsupportedData = 1003
+	WebSocketCloseNoStatus        = 1005 // never sent; peer closed without code
+	WebSocketCloseInvalidPayload  = 1007
+	WebSocketClosePolicyViolation = 1008
+	WebSocketCloseMessageTooBig   = 1009
+	WebSocketCloseInternalError   = 1011
+)
+
+// ErrWebSocketClosed is returned when writing to a WebSocket of which the
+// closing handshake started.
+var ErrWebSocketClosed = errors.New("xhttp: websocket closed")
+
+// WebSocketCloseError is returned by WebSocket.ReadMessage when the
+// connection was closed by the peer, or because the peer violated the
+// protocol.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error returns the error as string.
+func (e *WebSocketCloseError) Error() string {
+	msg := fmt.Sprintf("xhttp: websocket closed with code %d", e.Code)
+	if e.Reason != "" {
+		msg += " (" + e.Reason + ")"
+	}
+	return msg
+}
+
+// WebSocketOptions configures WebSocket connections, both for
+// UpgradeWebSocket and Client.DialWebSocket.
+type WebSocketOptions struct {
+	// MaxMessageSize is the maximum size in bytes of received messages,
+	// including all fragments. Larger messages close the connection with
+	// code 1009. Defaults to 1 MiB.
+	MaxMessageSize int64
+
+	// Subprotocols lists the supported subprotocols. Clients request them
+	// in order of preference; servers pick the first requested one which
+	// they support.
+	Subprotocols []string
+
+	// AllowedOrigins lists the origins allowed to connect, as with
+	// CORSOptions. When empty, servers only accept requests without Origin
+	// header, or of which the origin has the same host as the request.
+	// Not used by clients.
+	AllowedOrigins []string
+
+	// Header is sent with the handshake request by clients. Not used by
+	// servers.
+	Header http.Header
+}
+
+// WebSocket is a WebSocket connection as defined by RFC 6455. Messages are
+// read using ReadMessage, which must not be called concurrently. Writing
+// is safe for concurrent use. Control frames are handled while reading:
+// pings are answered, and closing the connection is acknowledged.
+type WebSocket struct {
+	rwc            io.ReadWriteCloser
+	br             *bufio.Reader
+	client         bool // clients mask frames
+	maxMessageSize int64
+	subprotocol    string
+
+	readErr error
+
+	wmu       sync.Mutex
+	closeSent bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newWebSocket(rwc io.ReadWriteCloser, br *bufio.Reader, client bool, opts WebSocketOptions) *WebSocket {
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = defaultWebSocketMaxMessageSize
+	}
+	return &WebSocket{
+		rwc:            rwc,
+		br:             br,
+		client:         client,
+		maxMessageSize: opts.MaxMessageSize,
+	}
+}
+
+// WebSocketHandler returns an http.Handler upgrading requests to
+// WebSocket connections, and calling fn with them. The connection is
+// closed when fn returns.
+//
+// For example, echoing messages:
+//
+//     mux.Handle(`^/echo$`, xhttp.WebSocketHandler(xhttp.WebSocketOptions{},
+//         func(ws *xhttp.WebSocket, r *http.Request) {
+//             for {
+//                 typ, msg, err := ws.ReadMessage()
+//                 if err != nil {
+//                     return
+//                 }
+//                 if err := ws.WriteMessage(typ, msg); err != nil {
+//                     return
+//                 }
+//             }
+//         }), xhttp.MethodGet)
+func WebSocketHandler(opts WebSocketOptions, fn func(ws *WebSocket, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := UpgradeWebSocket(w, r, opts)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.Close(WebSocketCloseNormal, "") }()
+
+		fn(ws, r)
+	})
+}
+
+// UpgradeWebSocket upgrades the request r to a WebSocket connection. When
+// r is not a valid WebSocket handshake, it replies with an HTTP error and
+// returns an error. The http.ResponseWriter w must support http.Hijacker,
+// and must not be used after upgrading.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request, opts WebSocketOptions) (*WebSocket, error) {
+	if r.Method != http.MethodGet {
+		MethodNotAllowed(w, r)
+		return nil, errors.New("xhttp: websocket handshake must use GET")
+	}
+
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		Error(w, r, http.StatusBadRequest, "400 not a websocket handshake", nil)
+		return nil, errors.New("xhttp: not a websocket handshake")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		Error(w, r, http.StatusUpgradeRequired, "426 unsupported websocket version", nil)
+		return nil, errors.New("xhttp: unsupported websocket version")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		Error(w, r, http.StatusBadRequest, "400 invalid websocket key", nil)
+		return nil, errors.New("xhttp: invalid websocket key")
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" && !websocketOriginAllowed(r, origin, opts.AllowedOrigins) {
+		Error(w, r, http.StatusForbidden, "403 origin not allowed", nil)
+		return nil, errors.New("xhttp: websocket origin not allowed")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		InternalError(w, r)
+		return nil, errors.New("xhttp: response writer does not support hijacking")
+	}
+
+	subprotocol := ""
+	for _, p := range headerTokens(r.Header, "Sec-WebSocket-Protocol") {
+		if xutil.HasString(opts.Subprotocols, p) {
+			subprotocol = p
+			break
+		}
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		InternalError(w, r)
+		return nil, fmt.Errorf("xhttp: hijacking connection (%w)", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	b.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	b.WriteString("\r\n")
+
+	_, err = brw.WriteString(b.String())
+	if err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("xhttp: writing websocket handshake (%w)", err)
+	}
+
+	ws := newWebSocket(conn, brw.Reader, false, opts)
+	ws.subprotocol = subprotocol
+	return ws, nil
+}
+
+// DialWebSocket opens a WebSocket connection to path, which is resolved
+// like with NewRequest, and can use the ws or wss scheme. The context is
+// only used for the handshake. The timeout of c must not be set, as it
+// would also apply to the connection.
+func (c *Client) DialWebSocket(ctx context.Context, path string, opts WebSocketOptions) (*WebSocket, error) {
+	var nonce [16]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	r := c.NewRequest(ctx, http.MethodGet, path)
+	for k := range opts.Header {
+		r.Header(k, opts.Header.Get(k))
+	}
+	r.Header("Upgrade", "websocket").
+		Header("Connection", "Upgrade").
+		Header("Sec-WebSocket-Key", key).
+		Header("Sec-WebSocket-Version", "13")
+	if len(opts.Subprotocols) > 0 {
+		r.Header("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ", "))
+	}
+
+	req, err := r.HTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+	switch req.URL.Scheme {
+	case "ws":
+		req.URL.Scheme = "http"
+	case "wss":
+		req.URL.Scheme = "https"
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStatusErrorBody))
+		_ = resp.Body.Close()
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       body,
+		}
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		return nil, errors.New("xhttp: websocket connection is not writable (is the client timeout set?)")
+	}
+
+	switch p := resp.Header.Get("Sec-WebSocket-Protocol"); {
+	case !headerHasToken(resp.Header, "Upgrade", "websocket") ||
+		!headerHasToken(resp.Header, "Connection", "upgrade"):
+		err = errors.New("xhttp: server did not upgrade to websocket")
+	case resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key):
+		err = errors.New("xhttp: invalid websocket accept key")
+	case p != "" && !xutil.HasString(opts.Subprotocols, p):
+		err = fmt.Errorf("xhttp: server chose unsupported websocket subprotocol %s", p)
+	}
+	if err != nil {
+		_ = rwc.Close()
+		return nil, err
+	}
+
+	ws := newWebSocket(rwc, bufio.NewReader(rwc), true, opts)
+	ws.subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	return ws, nil
+}
+
+// Subprotocol returns the negotiated subprotocol, or an empty string.
+func (ws *WebSocket) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// ReadMessage reads the next data message, blocking until it was
+// completely received. When the connection was closed, the error is
+// *WebSocketCloseError; once an error occurred, it is always returned.
+func (ws *WebSocket) ReadMessage() (WebSocketMessageType, []byte, error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+
+	typ, msg, err := ws.readMessage()
+	if err != nil {
+		ws.readErr = err
+	}
+	return typ, msg, err
+}
+
+// WriteMessage sends data as a single message of type typ.
+func (ws *WebSocket) WriteMessage(typ WebSocketMessageType, data []byte) error {
+	switch typ {
+	case WebSocketText:
+		if !utf8.Valid(data) {
+			return errors.New("xhttp: websocket text message is not valid UTF-8")
+		}
+	case WebSocketBinary:
+	default:
+		return fmt.Errorf("xhttp: invalid websocket message type %d", typ)
+	}
+	return ws.writeFrame(byte(typ), data)
+}
+
+// Ping sends a ping with data, which must be at most 125 bytes. The peer
+// answers with a pong, which is ignored.
+func (ws *WebSocket) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("xhttp: websocket ping data too long")
+	}
+	return ws.writeFrame(wsOpPing, data)
+}
+
+// Close sends a close frame with code and reason, and closes the
+// connection. The reason is truncated to at most 123 bytes, without
+// splitting UTF-8 encoded characters.
+func (ws *WebSocket) Close(code int, reason string) error {
+	err := ws.writeClose(code, reason)
+	if errors.Is(err, ErrWebSocketClosed) {
+		err = nil
+	}
+	if cerr := ws.closeConn(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// wsFrame is a single WebSocket frame.
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func (ws *WebSocket) readMessage() (WebSocketMessageType, []byte, error) {
+	var typ WebSocketMessageType
+	var msg []byte
+
+	for {
+		f, err := ws.readFrame(int64(len(msg)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, f.payload); err != nil && !errors.Is(err, ErrWebSocketClosed) {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return 0, nil, ws.handleClose(f.payload)
+		case wsOpText, wsOpBinary:
+			if typ != 0 {
+				return 0, nil, ws.fail(WebSocketCloseProtocolError, "expected continuation frame")
+			}
+			typ = WebSocketMessageType(f.opcode)
+		case wsOpContinuation:
+			if typ == 0 {
+				return 0, nil, ws.fail(WebSocketCloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, ws.fail(WebSocketCloseProtocolError, "unknown opcode")
+		}
+
+		msg = append(msg, f.payload...)
+		if !f.fin {
+			continue
+		}
+
+		if typ == WebSocketText && !utf8.Valid(msg) {
+			return 0, nil, ws.fail(WebSocketCloseInvalidPayload, "text message is not valid UTF-8")
+		}
+		if msg == nil {
+			msg = []byte{}
+		}
+		return typ, msg, nil
+	}
+}
+
+// readFrame reads the next frame. The size of the message received so
+// far is buffered.
+func (ws *WebSocket) readFrame(buffered int64) (wsFrame, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(ws.br, hdr[:2]); err != nil {
+		return wsFrame{}, fmt.Errorf("xhttp: reading websocket frame (%w)", err)
+	}
+
+	f := wsFrame{
+		fin:    hdr[0]&0x80 != 0,
+		opcode: hdr[0] & 0x0f,
+	}
+	if hdr[0]&0x70 != 0 {
+		return f, ws.fail(WebSocketCloseProtocolError, "reserved bits set")
+	}
+
+	masked := hdr[1]&0x80 != 0
+	if masked == ws.client {
+		return f, ws.fail(WebSocketCloseProtocolError, "incorrect masking")
+	}
+
+	n := int64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		if _, err := io.ReadFull(ws.br, hdr[:2]); err != nil {
+			return f, fmt.Errorf("xhttp: reading websocket frame (%w)", err)
+		}
+		n = int64(binary.BigEndian.Uint16(hdr[:2]))
+	case 127:
+		if _, err := io.ReadFull(ws.br, hdr[:8]); err != nil {
+			return f, fmt.Errorf("xhttp: reading websocket frame (%w)", err)
+		}
+		u := binary.BigEndian.Uint64(hdr[:8])
+		if u>>63 != 0 {
+			return f, ws.fail(WebSocketCloseProtocolError, "invalid payload length")
+		}
+		n = int64(u)
+	}
+
+	if f.opcode >= wsOpClose {
+		if n > maxControlPayload || !f.fin {
+			return f, ws.fail(WebSocketCloseProtocolError, "invalid control frame")
+		}
+	} else if buffered+n > ws.maxMessageSize {
+		return f, ws.fail(WebSocketCloseMessageTooBig, "message too big")
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.br, key[:]); err != nil {
+			return f, fmt.Errorf("xhttp: reading websocket frame (%w)", err)
+		}
+	}
+
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(ws.br, f.payload); err != nil {
+		return f, fmt.Errorf("xhttp: reading websocket frame (%w)", err)
+	}
+	if masked {
+		maskBytes(key, f.payload)
+	}
+
+	return f, nil
+}
+
+// handleClose acknowledges the close frame with payload, and closes the
+// connection.
+func (ws *WebSocket) handleClose(payload []byte) error {
+	code, reason := WebSocketCloseNoStatus, ""
+	if len(payload) == 1 {
+		return ws.fail(WebSocketCloseProtocolError, "invalid close frame")
+	}
+	if len(payload) >= 2 {
+		code = int(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+		if !validCloseCode(code) || !utf8.ValidString(reason) {
+			return ws.fail(WebSocketCloseProtocolError, "invalid close frame")
+		}
+	}
+
+	_ = ws.writeClose(code, "")
+	_ = ws.closeConn()
+	return &WebSocketCloseError{Code: code, Reason: reason}
+}
+
+// fail closes the connection with code because of a protocol violation
+// by the peer.
+func (ws *WebSocket) fail(code int, reason string) error {
+	_ = ws.writeClose(code, reason)
+	_ = ws.closeConn()
+	return &WebSocketCloseError{Code: code, Reason: reason}
+}
+
+func (ws *WebSocket) closeConn() error {
+	ws.closeOnce.Do(func() {
+		ws.closeErr = ws.rwc.Close()
+	})
+	return ws.closeErr
+}
+
+// writeClose sends a close frame, unless one was already sent.
+func (ws *WebSocket) writeClose(code int, reason string) error {
+	var payload []byte
+	if code != WebSocketCloseNoStatus {
+		reason = truncateUTF8(reason, maxControlPayload-2)
+		payload = make([]byte, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		copy(payload[2:], reason)
+	}
+
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	ws.closeSent = true
+	return ws.writeFrameLocked(wsOpClose, payload)
+}
+
+// truncateUTF8 returns s cut to at most n bytes, without splitting a
+// UTF-8 encoded character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+	return ws.writeFrameLocked(opcode, payload)
+}
+
+// writeFrameLocked writes a single, final frame. The caller must hold
+// the write lock.
+func (ws *WebSocket) writeFrameLocked(opcode byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|opcode)
+
+	var maskBit byte
+	if ws.client {
+		maskBit = 0x80
+	}
+
+	n := len(payload)
+	switch {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(n))
+		buf = append(append(buf, maskBit|127), size[:]...)
+	}
+
+	if ws.client {
+		var key [4]byte
+		if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+			return err
+		}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	_, err := ws.rwc.Write(buf)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// validCloseCode returns whether code can be received in a close frame.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// websocketAccept returns the value of the Sec-WebSocket-Accept header
+// for key.
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// websocketOriginAllowed returns whether origin can connect to r.
+func websocketOriginAllowed(r *http.Request, origin string, allowed []string) bool {
+	if len(allowed) > 0 {
+		return CORSOptions{AllowedOrigins: allowed}.originAllowed(origin)
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// headerTokens returns the comma-separated values of header name.
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// headerHasToken returns whether header name contains token, compared
+// case-insensitive.
+func headerHasToken(h http.Header, name, token string) bool {
+	return hasStringFold(headerTokens(h, name), token)
+}
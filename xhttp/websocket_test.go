@@ -0,0 +1,260 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestWebSocketAccept(t *testing.T) {
+	// example of RFC 6455, section 1.3
+	xt.Eq(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	xt.Eq(t, "short", truncateUTF8("short", 123))
+	xt.Eq(t, "ab", truncateUTF8("abc", 2))
+	xt.Eq(t, "a", truncateUTF8("aé", 2))
+	xt.Eq(t, "aé", truncateUTF8("aé", 3))
+	xt.Eq(t, "", truncateUTF8("€", 2))
+
+	reason := truncateUTF8(strings.Repeat("a", 122)+"é", 123)
+	xt.Eq(t, 122, len(reason))
+}
+
+func TestWebSocket(t *testing.T) {
+	closed := make(chan error, 1)
+
+	mux := NewServeReMux()
+	mux.Handle(`^/echo$`, WebSocketHandler(WebSocketOptions{MaxMessageSize: 1024, Subprotocols: []string{"chat"}},
+		func(ws *WebSocket, r *http.Request) {
+			for {
+				typ, msg, err := ws.ReadMessage()
+				if err != nil {
+					closed <- err
+					return
+				}
+				if err := ws.WriteMessage(typ, msg); err != nil {
+					return
+				}
+			}
+		}), MethodGet)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	t.Run("echo", func(t *testing.T) {
+		ws, err := c.DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+"/echo",
+			WebSocketOptions{Subprotocols: []string{"v2", "chat"}})
+		xt.OK(t, err)
+		xt.Eq(t, "chat", ws.Subprotocol())
+
+		xt.OK(t, ws.WriteMessage(WebSocketText, []byte("hello")))
+		typ, msg, err := ws.ReadMessage()
+		xt.OK(t, err)
+		xt.Eq(t, WebSocketText, typ)
+		xt.Eq(t, "hello", string(msg))
+
+		xt.OK(t, ws.Ping([]byte("ping")))
+		data := bytes.Repeat([]byte{0xff}, 300) // 16-bit payload length
+		xt.OK(t, ws.WriteMessage(WebSocketBinary, data))
+		typ, msg, err = ws.ReadMessage()
+		xt.OK(t, err)
+		xt.Eq(t, WebSocketBinary, typ)
+		xt.Eq(t, data, msg)
+
+		xt.OK(t, ws.Close(WebSocketCloseGoingAway, "bye"))
+		err = <-closed
+		var errClose *WebSocketCloseError
+		xt.Assert(t, errors.As(err, &errClose), err.Error())
+		xt.Eq(t, WebSocketCloseGoingAway, errClose.Code)
+		xt.Eq(t, "bye", errClose.Reason)
+
+		xt.Eq(t, ErrWebSocketClosed, ws.WriteMessage(WebSocketText, []byte("closed")))
+	})
+
+	t.Run("message too big", func(t *testing.T) {
+		ws, err := c.DialWebSocket(context.Background(), "echo", WebSocketOptions{})
+		xt.OK(t, err)
+		defer func() { _ = ws.Close(WebSocketCloseNormal, "") }()
+
+		xt.OK(t, ws.WriteMessage(WebSocketBinary, make([]byte, 1025)))
+		_, _, err = ws.ReadMessage()
+		var errClose *WebSocketCloseError
+		xt.Assert(t, errors.As(err, &errClose), err.Error())
+		xt.Eq(t, WebSocketCloseMessageTooBig, errClose.Code)
+		<-closed
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		ws, err := c.DialWebSocket(context.Background(), "echo", WebSocketOptions{})
+		xt.OK(t, err)
+		defer func() { _ = ws.Close(WebSocketCloseNormal, "") }()
+
+		const n = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- ws.WriteMessage(WebSocketText, []byte(fmt.Sprintf("message %d %s", i, strings.Repeat("x", 200))))
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			xt.OK(t, err)
+		}
+
+		seen := map[string]bool{}
+		for i := 0; i < n; i++ {
+			_, msg, err := ws.ReadMessage()
+			xt.OK(t, err)
+			seen[string(msg)] = true
+		}
+		xt.Eq(t, n, len(seen))
+	})
+
+	t.Run("handshake errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			header http.Header
+			status int
+		}{
+			{http.Header{}, http.StatusBadRequest},
+			{http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-WebSocket-Version": {"8"}},
+				http.StatusUpgradeRequired},
+			{http.Header{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"websocket"}, "Sec-WebSocket-Version": {"13"},
+				"Sec-WebSocket-Key": {"short"}}, http.StatusBadRequest},
+			{http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-WebSocket-Version": {"13"},
+				"Sec-WebSocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}, "Origin": {"https://evil.example.com"}},
+				http.StatusForbidden},
+		} {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/echo", nil)
+			xt.OK(t, err)
+			req.Header = tc.header
+			resp, err := http.DefaultClient.Do(req)
+			xt.OK(t, err)
+			_ = resp.Body.Close()
+			xt.Eq(t, tc.status, resp.StatusCode)
+		}
+	})
+}
+
+func TestWebSocket_ReadMessage(t *testing.T) {
+	// frame returns a masked frame as sent by clients.
+	frame := func(fin bool, opcode byte, payload string) []byte {
+		b0 := opcode
+		if fin {
+			b0 |= 0x80
+		}
+		key := [4]byte{1, 2, 3, 4}
+		data := []byte(payload)
+		maskBytes(key, data)
+		return append([]byte{b0, 0x80 | byte(len(data)), 1, 2, 3, 4}, data...)
+	}
+
+	t.Run("fragmented message with ping", func(t *testing.T) {
+		server, client := net.Pipe()
+		defer func() { _ = client.Close() }()
+		ws := newWebSocket(server, bufio.NewReader(server), false, WebSocketOptions{})
+
+		go func() {
+			_, _ = client.Write(frame(false, wsOpText, "hel"))
+			_, _ = client.Write(frame(true, wsOpPing, "are you there"))
+			_, _ = client.Write(frame(false, wsOpContinuation, "lo "))
+			_, _ = client.Write(frame(true, wsOpContinuation, "world"))
+		}()
+
+		pong := make(chan []byte, 1)
+		go func() {
+			buf := make([]byte, 64)
+			n, _ := client.Read(buf)
+			pong <- buf[:n]
+		}()
+
+		typ, msg, err := ws.ReadMessage()
+		xt.OK(t, err)
+		xt.Eq(t, WebSocketText, typ)
+		xt.Eq(t, "hello world", string(msg))
+		xt.Eq(t, append([]byte{0x80 | wsOpPong, 13}, "are you there"...), <-pong)
+	})
+
+	t.Run("protocol errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			frames [][]byte
+			code   int
+		}{
+			{[][]byte{frame(true, wsOpContinuation, "x")}, WebSocketCloseProtocolError},
+			{[][]byte{frame(false, wsOpText, "a"), frame(true, wsOpText, "b")}, WebSocketCloseProtocolError},
+			{[][]byte{frame(true, wsOpText, "\xff\xfe")}, WebSocketCloseInvalidPayload},
+			{[][]byte{frame(false, wsOpPing, "")}, WebSocketCloseProtocolError},
+			{[][]byte{{0x81, 0x01, 'x'}}, WebSocketCloseProtocolError}, // not masked
+			{[][]byte{frame(true, 0x3, "")}, WebSocketCloseProtocolError},
+		} {
+			server, client := net.Pipe()
+			ws := newWebSocket(server, bufio.NewReader(server), false, WebSocketOptions{})
+
+			go func() {
+				for _, f := range tc.frames {
+					_, _ = client.Write(f)
+				}
+			}()
+			reply := make(chan []byte, 1)
+			go func() {
+				buf := make([]byte, 128)
+				n, _ := client.Read(buf)
+				reply <- buf[:n]
+			}()
+
+			_, _, err := ws.ReadMessage()
+			var errClose *WebSocketCloseError
+			xt.Assert(t, errors.As(err, &errClose), fmt.Sprint(err))
+			xt.Eq(t, tc.code, errClose.Code)
+
+			r := <-reply
+			xt.Assert(t, len(r) >= 4, "expected close frame")
+			xt.Eq(t, byte(0x80|wsOpClose), r[0])
+			xt.Eq(t, tc.code, int(r[2])<<8|int(r[3]))
+
+			_, _, again := ws.ReadMessage()
+			xt.Eq(t, err, again)
+			_ = client.Close()
+		}
+	})
+}
+
+func TestClient_DialWebSocket(t *testing.T) {
+	header := make(chan http.Header, 1)
+	srv := httptest.NewServer(WebSocketHandler(WebSocketOptions{}, func(ws *WebSocket, r *http.Request) {
+		header <- r.Header.Clone()
+		_ = ws.Close(WebSocketCloseNormal, "")
+	}))
+	defer srv.Close()
+
+	t.Run("custom header", func(t *testing.T) {
+		ws, err := NewClient(srv.URL).DialWebSocket(context.Background(), srv.URL, WebSocketOptions{
+			Header: http.Header{"Authorization": {"Bearer secret"}, "Upgrade": {"h2c"}},
+		})
+		xt.OK(t, err)
+		defer func() { _ = ws.Close(WebSocketCloseNormal, "") }()
+
+		h := <-header
+		xt.Eq(t, "Bearer secret", h.Get("Authorization"))
+		xt.Eq(t, "websocket", h.Get("Upgrade"), "handshake headers must not be overwritten")
+	})
+}
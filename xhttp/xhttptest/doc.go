@@ -0,0 +1,11 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+/*
+Package xhttptest contains tools for testing HTTP clients without network
+access.
+
+Recorder is an http.RoundTripper recording interactions with real servers
+to golden files, and replaying them. Server is a fake HTTP server replying
+with scripted responses.
+*/
+package xhttptest
@@ -0,0 +1,325 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/geertjanvdk/xkit/xhttp"
+)
+
+// Mode defines whether Recorder records or replays interactions.
+type Mode int
+
+const (
+	// ModeReplay replays the interactions stored in the golden file. No
+	// network connections are made.
+	ModeReplay Mode = iota
+
+	// ModeRecord sends requests and records the interactions. They are
+	// written to the golden file by Recorder.Save.
+	ModeRecord
+)
+
+// Redacted replaces the values of redacted headers.
+const Redacted = "REDACTED"
+
+// DefaultRedactHeaders are the headers of which the values are redacted
+// when recording.
+var DefaultRedactHeaders = []string{
+	"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key",
+}
+
+// RecordedRequest is a request stored in a golden file. Secrets in the
+// URL are redacted using xhttp.RedactURL.
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// RecordedResponse is a response stored in a golden file.
+type RecordedResponse struct {
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// Interaction is a request with its response stored in a golden file.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// MatchFunc returns whether req, with its body, matches the recorded
+// request.
+type MatchFunc func(req *http.Request, body []byte, recorded RecordedRequest) bool
+
+// MatchMethodURL matches requests on their method and URL. Secrets in the
+// URL of req are redacted before comparing.
+func MatchMethodURL(req *http.Request, _ []byte, recorded RecordedRequest) bool {
+	return req.Method == recorded.Method &&
+		(xhttp.RedactURL(req.URL) == recorded.URL || req.URL.String() == recorded.URL)
+}
+
+// MatchMethodURLBody matches requests on their method, URL, and body.
+func MatchMethodURLBody(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	if !MatchMethodURL(req, body, recorded) {
+		return false
+	}
+	data, err := decodeBody(recorded.Body, recorded.BodyEncoding)
+	return err == nil && bytes.Equal(body, data)
+}
+
+// Recorder is an http.RoundTripper which records interactions with real
+// servers to a golden file, and replays them. This makes tests of HTTP
+// clients deterministic, and lets them run without network access.
+//
+// For example, recording when the environment variable RECORD is set:
+//
+//     mode := xhttptest.ModeReplay
+//     if os.Getenv("RECORD") != "" {
+//         mode = xhttptest.ModeRecord
+//     }
+//     rec, err := xhttptest.NewRecorder("testdata/users.json", mode)
+//     xt.OK(t, err)
+//     defer func() { xt.OK(t, rec.Save()) }()
+//
+//     c := xhttp.NewClient(uri, xhttp.WithRoundTripper(rec))
+type Recorder struct {
+	// Transport is used to send requests when recording. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Match is used to find the recorded interaction of requests when
+	// replaying. Defaults to MatchMethodURLBody.
+	Match MatchFunc
+
+	// RedactHeaders lists headers of which the values are replaced with
+	// Redacted when recording. Defaults to DefaultRedactHeaders. Query
+	// parameters are redacted using xhttp.RedactQueryParams.
+	RedactHeaders []string
+
+	file string
+	mode Mode
+
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewRecorder instantiates a Recorder using the golden file. When
+// replaying, the file is read and must exist.
+func NewRecorder(file string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		file: file,
+		mode: mode,
+	}
+
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("xhttptest: reading golden file (%w)", err)
+	}
+
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("xhttptest: decoding golden file %s (%w)", file, err)
+	}
+	r.replayed = make([]bool, len(r.interactions))
+
+	return r, nil
+}
+
+// Interactions returns the recorded interactions.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// RoundTrip implements the http.RoundTripper interface. When replaying,
+// each recorded interaction is used once, in the order they were recorded.
+// An error is returned when no interaction matches the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	match := r.Match
+	if match == nil {
+		match = MatchMethodURLBody
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.interactions {
+		if r.replayed[i] || !match(req, body, in.Request) {
+			continue
+		}
+		r.replayed[i] = true
+
+		respBody, err := decodeBody(in.Response.Body, in.Response.BodyEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("xhttptest: decoding recorded body (%w)", err)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("xhttptest: no recorded interaction for %s %s", req.Method, req.URL)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = nil
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    xhttp.RedactURL(req.URL),
+			Header: r.redact(req.Header),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.redact(resp.Header),
+		},
+	}
+	in.Request.Body, in.Request.BodyEncoding = encodeBody(body)
+	in.Response.Body, in.Response.BodyEncoding = encodeBody(respBody)
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// Save writes the recorded interactions to the golden file, creating
+// its directory when needed. It does nothing when replaying.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.file), 0o755); err != nil {
+		return fmt.Errorf("xhttptest: creating directory of golden file (%w)", err)
+	}
+
+	if err := os.WriteFile(r.file, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("xhttptest: writing golden file (%w)", err)
+	}
+	return nil
+}
+
+// redact returns a copy of h with the values of the redacted headers
+// replaced.
+func (r *Recorder) redact(h http.Header) http.Header {
+	names := r.RedactHeaders
+	if names == nil {
+		names = DefaultRedactHeaders
+	}
+
+	c := h.Clone()
+	for name := range c {
+		for _, n := range names {
+			if strings.EqualFold(name, n) {
+				c[name] = []string{Redacted}
+			}
+		}
+	}
+	return c
+}
+
+// readBody reads and closes the body of req.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	return data, err
+}
+
+// encodeBody returns body as string, base64 encoded when it is not valid
+// UTF-8.
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return nil, errors.New("unsupported body encoding " + encoding)
+}
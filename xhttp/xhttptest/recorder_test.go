@@ -0,0 +1,103 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttptest
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/geertjanvdk/xkit/xhttp"
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestRecorder(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.On(http.MethodPost, `^/users$`).ReplyJSON(http.StatusCreated, map[string]string{"id": "1"})
+	srv.On(http.MethodGet, `^/users/1$`).
+		ReplyJSON(http.StatusOK, map[string]string{"name": "alice"}).
+		ReplyJSON(http.StatusOK, map[string]string{"name": "alice b."})
+
+	golden := filepath.Join(t.TempDir(), "testdata", "users.json")
+	ctx := context.Background()
+
+	// run is the code under test, making the same requests when recording
+	// and replaying.
+	run := func(t *testing.T, rt http.RoundTripper) []string {
+		c := xhttp.NewClient(srv.URL, xhttp.WithRoundTripper(rt), xhttp.WithBearer("s3cret"))
+
+		var created map[string]string
+		_, err := c.NewRequest(ctx, http.MethodPost, "users").JSON(map[string]string{"name": "alice"}).Do(&created)
+		xt.OK(t, err)
+
+		names := []string{created["id"]}
+		for i := 0; i < 2; i++ {
+			var user map[string]string
+			_, err := c.NewRequest(ctx, http.MethodGet, "users/1").Query("api_key", "k3y").Do(&user)
+			xt.OK(t, err)
+			names = append(names, user["name"])
+		}
+		return names
+	}
+
+	t.Run("record", func(t *testing.T) {
+		rec, err := NewRecorder(golden, ModeRecord)
+		xt.OK(t, err)
+
+		xt.Eq(t, []string{"1", "alice", "alice b."}, run(t, rec))
+		xt.OK(t, rec.Save())
+
+		interactions := rec.Interactions()
+		xt.Eq(t, 3, len(interactions))
+		xt.Eq(t, Redacted, interactions[0].Request.Header.Get(xhttp.HeaderAuthorization))
+		xt.Eq(t, `{"name":"alice"}`, interactions[0].Request.Body)
+		xt.Eq(t, srv.URL+"/users/1?api_key=REDACTED", interactions[1].Request.URL)
+	})
+
+	srv.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		rec, err := NewRecorder(golden, ModeReplay)
+		xt.OK(t, err)
+
+		xt.Eq(t, []string{"1", "alice", "alice b."}, run(t, rec))
+		xt.OK(t, rec.Save())
+	})
+
+	t.Run("no matching interaction", func(t *testing.T) {
+		rec, err := NewRecorder(golden, ModeReplay)
+		xt.OK(t, err)
+
+		c := xhttp.NewClient(srv.URL, xhttp.WithRoundTripper(rec))
+		_, err = c.NewRequest(ctx, http.MethodPost, "users").JSON(map[string]string{"name": "bob"}).Do(nil)
+		xt.KO(t, err)
+		xt.Match(t, ".*no recorded interaction for POST .*/users", err.Error())
+	})
+
+	t.Run("match on method and URL", func(t *testing.T) {
+		rec, err := NewRecorder(golden, ModeReplay)
+		xt.OK(t, err)
+		rec.Match = MatchMethodURL
+
+		c := xhttp.NewClient(srv.URL, xhttp.WithRoundTripper(rec))
+		_, err = c.NewRequest(ctx, http.MethodPost, "users").JSON(map[string]string{"name": "bob"}).Do(nil)
+		xt.OK(t, err)
+	})
+
+	t.Run("golden file missing", func(t *testing.T) {
+		_, err := NewRecorder(filepath.Join(t.TempDir(), "missing.json"), ModeReplay)
+		xt.KO(t, err)
+	})
+}
+
+func TestEncodeBody(t *testing.T) {
+	body, enc := encodeBody([]byte{0xff, 0x00, 0x01})
+	xt.Eq(t, "base64", enc)
+
+	data, err := decodeBody(body, enc)
+	xt.OK(t, err)
+	xt.Eq(t, []byte{0xff, 0x00, 0x01}, data)
+}
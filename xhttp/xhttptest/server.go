@@ -0,0 +1,176 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+
+	"github.com/geertjanvdk/xkit/xhttp"
+)
+
+// Server is a fake HTTP server replying with scripted responses. It wraps
+// httptest.Server, and records the requests it receives.
+//
+// For example:
+//
+//     srv := xhttptest.NewServer()
+//     defer srv.Close()
+//
+//     srv.On(http.MethodGet, `^/users/\d+$`).
+//         ReplyJSON(http.StatusServiceUnavailable, nil).
+//         ReplyJSON(http.StatusOK, User{Name: "alice"})
+//
+//     c := xhttp.NewClient(srv.URL)
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	routes   []*Route
+	requests []RecordedRequest
+}
+
+// NewServer starts and returns a new Server. Requests which do not match
+// any route are answered with HTTP status 404. The server must be closed
+// when done.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Route holds the scripted responses for requests matching a method and
+// a pattern.
+type Route struct {
+	method  string
+	regex   *regexp.Regexp
+	mu      sync.Mutex
+	replies []http.HandlerFunc
+	calls   int
+}
+
+// On returns a new route for requests using method of which the path
+// matches the regular expression pattern. When method is empty, any
+// method matches. Routes are matched in the order they were added.
+// Panics when pattern is not a valid regular expression.
+func (s *Server) On(method, pattern string) *Route {
+	r := &Route{
+		method: method,
+		regex:  regexp.MustCompile(pattern),
+	}
+
+	s.mu.Lock()
+	s.routes = append(s.routes, r)
+	s.mu.Unlock()
+
+	return r
+}
+
+// ReplyFunc adds h to the responses of r. Responses are used in the order
+// they were added; the last response is repeated.
+func (r *Route) ReplyFunc(h http.HandlerFunc) *Route {
+	r.mu.Lock()
+	r.replies = append(r.replies, h)
+	r.mu.Unlock()
+	return r
+}
+
+// Reply adds a response with status, and body as plain text. Headers are
+// given as key, value pairs.
+func (r *Route) Reply(status int, body string, headers ...string) *Route {
+	return r.ReplyFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(xhttp.HeaderContentType, xhttp.ContentTypePlain)
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+// ReplyJSON adds a response with status, and v encoded as JSON as body.
+// When v is nil, there is no body.
+func (r *Route) ReplyJSON(status int, v interface{}) *Route {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic("xhttptest: encoding reply: " + err.Error())
+	}
+
+	return r.ReplyFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if v == nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set(xhttp.HeaderContentType, xhttp.ContentTypeJSON)
+		w.WriteHeader(status)
+		_, _ = w.Write(append(data, '\n'))
+	})
+}
+
+// Calls returns how many requests matched r.
+func (r *Route) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+// next returns the response for the next call of r.
+func (r *Route) next() http.HandlerFunc {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if len(r.replies) == 0 {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	i := r.calls - 1
+	if i >= len(r.replies) {
+		i = len(r.replies) - 1
+	}
+	return r.replies[i]
+}
+
+// Requests returns the requests received by s, in order.
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := readBody(req)
+	if err != nil {
+		xhttp.InternalError(w, req)
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}
+	rec.Body, rec.BodyEncoding = encodeBody(body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, rec)
+	routes := append([]*Route(nil), s.routes...)
+	s.mu.Unlock()
+
+	for _, r := range routes {
+		if (r.method == "" || r.method == req.Method) && r.regex.MatchString(req.URL.Path) {
+			r.next()(w, req)
+			return
+		}
+	}
+
+	xhttp.NotFound(w, req)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022, Geert JM Vanderkelen
+
+package xhttptest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/geertjanvdk/xkit/xhttp"
+	"github.com/geertjanvdk/xkit/xt"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	items := srv.On(http.MethodGet, `^/items$`).
+		Reply(http.StatusServiceUnavailable, "busy", "Retry-After", "0").
+		ReplyJSON(http.StatusOK, []string{"a", "b"})
+	echo := srv.On("", `^/echo$`).ReplyFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+
+	ctx := context.Background()
+	c := xhttp.NewClient(srv.URL, xhttp.WithRetry(xhttp.RetryPolicy{InitialBackoff: time.Millisecond}))
+
+	t.Run("scripted responses", func(t *testing.T) {
+		var got []string
+		_, err := c.NewRequest(ctx, http.MethodGet, "items").Do(&got)
+		xt.OK(t, err)
+		xt.Eq(t, []string{"a", "b"}, got)
+		xt.Eq(t, 2, items.Calls())
+
+		_, err = c.NewRequest(ctx, http.MethodGet, "items").Do(&got)
+		xt.OK(t, err)
+		xt.Eq(t, 3, items.Calls(), "last response is repeated")
+	})
+
+	t.Run("any method", func(t *testing.T) {
+		var got string
+		_, err := c.NewRequest(ctx, http.MethodPut, "echo").Body(xhttp.ContentTypePlain, []byte("ping")).Do(&got)
+		xt.OK(t, err)
+		xt.Eq(t, "ping", got)
+		xt.Eq(t, 1, echo.Calls())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := c.NewRequest(ctx, http.MethodDelete, "items").Do(nil)
+		var se *xhttp.StatusError
+		xt.Assert(t, errors.As(err, &se))
+		xt.Eq(t, http.StatusNotFound, se.StatusCode)
+	})
+
+	t.Run("requests", func(t *testing.T) {
+		reqs := srv.Requests()
+		xt.Eq(t, 5, len(reqs))
+		xt.Eq(t, http.MethodPut, reqs[3].Method)
+		xt.Eq(t, "/echo", reqs[3].URL)
+		xt.Eq(t, "ping", reqs[3].Body)
+	})
+}